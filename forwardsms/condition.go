@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Condition 组合条件树，同一节点上配置的多项需要同时满足。
+// all_of/any_of/none_of 可以任意嵌套，叶子条件为 keyword/regex/sender/phone_id/time
+type Condition struct {
+	AllOf  []*Condition `yaml:"all_of" doc:"全部满足"`
+	AnyOf  []*Condition `yaml:"any_of" doc:"任意一项满足"`
+	NoneOf []*Condition `yaml:"none_of" doc:"全部不满足"`
+
+	Keyword string         `yaml:"keyword" doc:"短信内容包含关键字"`
+	Regex   string         `yaml:"regex" doc:"短信内容匹配正则表达式"`
+	Sender  *StringMatcher `yaml:"sender" doc:"发送人号码，写法同规则的 number"`
+	PhoneID *StringMatcher `yaml:"phone_id" doc:"接收 SIM 卡的 phone_id，写法同规则的 phone_id"`
+	Time    string         `yaml:"time" doc:"接收时间段，如 09:00-18:00，支持跨零点的 22:00-07:00"`
+
+	regex     *regexp.Regexp
+	timeStart int // 一天中的分钟数
+	timeEnd   int
+}
+
+// UnmarshalYAML 解析条件并预先编译正则、时间段
+func (c *Condition) UnmarshalYAML(value *yaml.Node) error {
+	type plain Condition
+	if err := value.Decode((*plain)(c)); err != nil {
+		return err
+	}
+	if value.Kind == yaml.MappingNode {
+		known := yamlFields(reflect.ValueOf(c).Elem())
+		for i := 0; i+1 < len(value.Content); i += 2 {
+			if _, ok := known[value.Content[i].Value]; !ok {
+				return fmt.Errorf("第 %d 行: 不支持的条件 %s", value.Content[i].Line, value.Content[i].Value)
+			}
+		}
+	}
+	if reflect.ValueOf(*c).IsZero() {
+		return fmt.Errorf("第 %d 行: 条件不能为空", value.Line)
+	}
+	if c.Regex != "" {
+		re, err := regexp.Compile(c.Regex)
+		if err != nil {
+			return fmt.Errorf("第 %d 行: 正则表达式错误: %v", value.Line, err)
+		}
+		c.regex = re
+	}
+	if c.Time != "" {
+		start, end, err := parseTimeRange(c.Time)
+		if err != nil {
+			return fmt.Errorf("第 %d 行: %v", value.Line, err)
+		}
+		c.timeStart, c.timeEnd = start, end
+	}
+	return nil
+}
+
+// JSONSchema 条件可以递归嵌套，通过 definitions 引用
+func (Condition) JSONSchema() map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/definitions/condition"}
+}
+
+// conditionResult 条件求值结果，来电没有短信内容，内容条件不参与判断
+type conditionResult int
+
+const (
+	condFalse conditionResult = iota
+	condTrue
+	condSkip
+)
+
+// Eval 判断输入是否满足条件
+func (c *Condition) Eval(in *MatchInput) bool {
+	return c == nil || c.eval(in) != condFalse
+}
+
+func (c *Condition) eval(in *MatchInput) conditionResult {
+	var results []conditionResult
+	if c.Keyword != "" || c.regex != nil {
+		switch {
+		case in.Call:
+			results = append(results, condSkip)
+		default:
+			results = append(results, boolResult((c.Keyword == "" || strings.Contains(in.Text, c.Keyword)) &&
+				(c.regex == nil || c.regex.MatchString(in.Text))))
+		}
+	}
+	if c.Sender != nil {
+		results = append(results, boolResult(c.Sender.Match(numberVariants(in.Number)...)))
+	}
+	if c.PhoneID != nil {
+		results = append(results, boolResult(c.PhoneID.Match(in.PhoneID)))
+	}
+	if c.Time != "" {
+		results = append(results, boolResult(inTimeRange(in.Time, c.timeStart, c.timeEnd)))
+	}
+	if len(c.AllOf) > 0 {
+		results = append(results, evalAll(c.AllOf, in))
+	}
+	if len(c.AnyOf) > 0 {
+		results = append(results, evalAny(c.AnyOf, in))
+	}
+	if len(c.NoneOf) > 0 {
+		results = append(results, not(evalAny(c.NoneOf, in)))
+	}
+	return combineAll(results)
+}
+
+func evalAll(conds []*Condition, in *MatchInput) conditionResult {
+	results := make([]conditionResult, 0, len(conds))
+	for _, c := range conds {
+		results = append(results, c.eval(in))
+	}
+	return combineAll(results)
+}
+
+func evalAny(conds []*Condition, in *MatchInput) conditionResult {
+	result := condSkip
+	for _, c := range conds {
+		switch c.eval(in) {
+		case condTrue:
+			return condTrue
+		case condFalse:
+			result = condFalse
+		}
+	}
+	return result
+}
+
+// combineAll 全部满足：有一项不满足即不满足，全部跳过时结果也是跳过
+func combineAll(results []conditionResult) conditionResult {
+	result := condSkip
+	for _, r := range results {
+		switch r {
+		case condFalse:
+			return condFalse
+		case condTrue:
+			result = condTrue
+		}
+	}
+	return result
+}
+
+func not(r conditionResult) conditionResult {
+	switch r {
+	case condTrue:
+		return condFalse
+	case condFalse:
+		return condTrue
+	}
+	return condSkip
+}
+
+func boolResult(b bool) conditionResult {
+	if b {
+		return condTrue
+	}
+	return condFalse
+}
+
+// parseTimeRange 解析 HH:MM-HH:MM，返回一天中的起止分钟数
+func parseTimeRange(s string) (int, int, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("时间段格式应为 HH:MM-HH:MM: %s", s)
+	}
+	var minutes [2]int
+	for i, part := range []string{from, to} {
+		t, err := time.Parse("15:04", strings.TrimSpace(part))
+		if err != nil {
+			return 0, 0, fmt.Errorf("时间段格式应为 HH:MM-HH:MM: %s", s)
+		}
+		minutes[i] = t.Hour()*60 + t.Minute()
+	}
+	return minutes[0], minutes[1], nil
+}
+
+// inTimeRange 判断时间是否在 [start, end) 内，start 大于 end 时表示跨零点
+func inTimeRange(t time.Time, start, end int) bool {
+	m := t.Hour()*60 + t.Minute()
+	if start <= end {
+		return m >= start && m < end
+	}
+	return m >= start || m < end
+}
+
+// parseEventTime 解析 gammu-smsd 传入的时间，无法解析时使用当前时间
+func parseEventTime(s string) time.Time {
+	for _, layout := range []string{"2006-01-02 15:04:05", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t
+		}
+	}
+	return time.Now()
+}
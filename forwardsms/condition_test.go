@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+func parseCondition(t *testing.T, data string) *Condition {
+	t.Helper()
+	var c Condition
+	if err := yaml.Unmarshal([]byte(data), &c); err != nil {
+		t.Fatalf("解析条件失败: %v\n%s", err, data)
+	}
+	return &c
+}
+
+func TestConditionEval(t *testing.T) {
+	at := func(clock string) time.Time {
+		tm, _ := time.Parse("15:04", clock)
+		return tm
+	}
+	code := `
+all_of:
+  - keyword: 验证码
+  - sender: {prefix: ["106"]}
+  - none_of:
+      - keyword: 退订
+`
+	cases := []struct {
+		name string
+		cond string
+		in   MatchInput
+		want bool
+	}{
+		{"验证码且106开头", code, MatchInput{Text: "您的验证码 1234", Number: "1069001"}, true},
+		{"+86 前缀的106号码", code, MatchInput{Text: "您的验证码 1234", Number: "+861069001"}, true},
+		{"包含退订", code, MatchInput{Text: "验证码 1234，回复TD退订", Number: "1069001"}, false},
+		{"非106号码", code, MatchInput{Text: "您的验证码 1234", Number: "13800000000"}, false},
+		{"缺少关键字", code, MatchInput{Text: "您好", Number: "1069001"}, false},
+		{"any_of 任意一项", "any_of:\n  - keyword: 银行\n  - regex: '\\d{6}'\n", MatchInput{Text: "动态码 123456"}, true},
+		{"any_of 都不满足", "any_of:\n  - keyword: 银行\n  - regex: '\\d{6}'\n", MatchInput{Text: "动态码 1234"}, false},
+		{"同一节点多项同时满足", "keyword: 验证码\nphone_id: SMS1\n", MatchInput{Text: "验证码", PhoneID: "SMS2"}, false},
+		{"工作时间内", "time: 09:00-18:00\n", MatchInput{Time: at("09:00")}, true},
+		{"工作时间结束", "time: 09:00-18:00\n", MatchInput{Time: at("18:00")}, false},
+		{"跨零点夜间", "time: 22:00-07:00\n", MatchInput{Time: at("23:30")}, true},
+		{"跨零点凌晨", "time: 22:00-07:00\n", MatchInput{Time: at("06:59")}, true},
+		{"跨零点白天", "time: 22:00-07:00\n", MatchInput{Time: at("12:00")}, false},
+		{"多层嵌套", "any_of:\n  - all_of:\n      - keyword: a\n      - keyword: b\n  - none_of:\n      - phone_id: SMS1\n", MatchInput{Text: "c", PhoneID: "SMS1"}, false},
+		// 来电没有内容，内容条件跳过，只检查号码
+		{"来电跳过内容条件", code, MatchInput{Call: true, Number: "1069001"}, true},
+		{"来电号码不满足", code, MatchInput{Call: true, Number: "13800000000"}, false},
+		{"来电 none_of 只有内容条件", "none_of:\n  - keyword: 退订\n", MatchInput{Call: true}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := parseCondition(t, c.cond).Eval(&c.in); got != c.want {
+				t.Fatalf("结果 %v, 期望 %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestConditionErrors(t *testing.T) {
+	for _, data := range []string{
+		"{}",
+		"keywords: 验证码",
+		"regex: '('",
+		"time: 9点-18点",
+		"all_of:\n  - {}\n",
+	} {
+		var c Condition
+		if err := yaml.Unmarshal([]byte(data), &c); err == nil {
+			t.Errorf("应返回错误: %s", data)
+		}
+	}
+}
+
+func TestRuleWhen(t *testing.T) {
+	data := `
+code:
+  when:
+    all_of:
+      - keyword: 验证码
+      - none_of:
+          - keyword: 退订
+  notify: bark
+  url: http://x
+`
+	set, err := ParseRuleSet("forward.yaml", []byte(data))
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	rule, _ := set.Get("code")
+	if rule.Type != "all" {
+		t.Fatalf("配置 when 时 type 默认为 all: %q", rule.Type)
+	}
+	if !rule.Match(&MatchInput{Text: "验证码 1234"}) || rule.Match(&MatchInput{Text: "验证码 1234 退订回T"}) {
+		t.Fatal("when 条件未生效")
+	}
+}
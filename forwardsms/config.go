@@ -0,0 +1,318 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"go.yaml.in/yaml/v3"
+)
+
+// Rule 一条转发规则，notify 对应渠道的配置项与规则写在同一层
+type Rule struct {
+	Name   string `yaml:"-"`
+	Type   string `yaml:"type" enum:"all,keyword,regex,expr" doc:"匹配方式: all 全部转发, keyword 关键字, regex 正则表达式, expr CEL 表达式；配置了 when 时可省略"`
+	Rule   string `yaml:"rule" doc:"关键字、正则表达式或 CEL 表达式，type 为 all 时可省略"`
+	Notify string `yaml:"notify" required:"true" doc:"推送渠道"`
+
+	Priority int  `yaml:"priority" doc:"优先级，数值大的先匹配，相同时按文件中的顺序，默认 0"`
+	Stop     bool `yaml:"stop" doc:"命中后不再匹配后面的规则"`
+	Fallback bool `yaml:"fallback" doc:"兜底规则，只在其他规则都没有命中时匹配"`
+
+	Number  *StringMatcher `yaml:"number" doc:"发送人号码条件，可写单个号码、号码列表或 exact/prefix/regex 映射；+86 开头的号码也会去掉前缀匹配"`
+	PhoneID *StringMatcher `yaml:"phone_id" doc:"接收 SIM 卡的 phone_id 条件，写法同 number"`
+	When    *Condition     `yaml:"when" doc:"组合条件，支持 all_of/any_of/none_of 嵌套"`
+
+	Template      string `yaml:"template" doc:"消息内容模板 (Go text/template)，如 {{.Number}}: {{.Text}}，不填使用默认格式"`
+	TitleTemplate string `yaml:"title_template" doc:"消息标题模板，不填时短信为 短信通知，来电为 来电通知"`
+
+	line        int
+	fingerprint string // 规则原始配置，热加载时用于判断规则是否变化
+	regex       *regexp.Regexp
+	program     cel.Program
+	notifier    Notifier
+
+	template      *template.Template
+	titleTemplate *template.Template
+}
+
+// RuleSet 从 forward.yaml 解析出的全部规则，按优先级从高到低排列，相同优先级保持文件中的顺序
+type RuleSet struct {
+	Rules    []*Rule
+	Version  int       // 加载次数，每次成功热加载加一
+	LoadedAt time.Time // 加载时间
+	Checksum string    // 配置文件的 sha256，内容未变化时跳过重新加载
+	byName   map[string]*Rule
+}
+
+// Get 按名称查找规则
+func (s *RuleSet) Get(name string) (*Rule, bool) {
+	r, ok := s.byName[name]
+	return r, ok
+}
+
+// Select 按顺序选出命中的规则：命中 stop 规则后停止，没有普通规则命中时才匹配兜底规则
+func (s *RuleSet) Select(match func(*Rule) bool) []*Rule {
+	var selected []*Rule
+	for _, fallback := range []bool{false, true} {
+		for _, r := range s.Rules {
+			if r.Fallback != fallback || !match(r) {
+				continue
+			}
+			selected = append(selected, r)
+			if r.Stop {
+				break
+			}
+		}
+		if len(selected) > 0 {
+			break
+		}
+	}
+	return selected
+}
+
+// LoadRuleSet 读取并校验规则文件
+func LoadRuleSet(path string) (*RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	set, err := ParseRuleSet(filepath.Base(path), data)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	set.Checksum = hex.EncodeToString(sum[:])
+	set.LoadedAt = time.Now()
+	return set, nil
+}
+
+// ParseRuleSet 解析规则文件内容，所有错误都带上行号一起返回
+func ParseRuleSet(filename string, data []byte) (*RuleSet, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	set := &RuleSet{byName: map[string]*Rule{}}
+	if len(doc.Content) == 0 {
+		return set, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s:%d: 顶层应为 规则名: 规则配置 的映射", filename, root.Line)
+	}
+
+	var errs []error
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		if _, ok := set.byName[key.Value]; ok {
+			errs = append(errs, fmt.Errorf("%s:%d: 规则 %q 重复定义", filename, key.Line, key.Value))
+			continue
+		}
+		rule, ruleErrs := parseRule(key, value)
+		for _, err := range ruleErrs {
+			errs = append(errs, fmt.Errorf("%s:%v", filename, err))
+		}
+		if len(ruleErrs) == 0 {
+			set.Rules = append(set.Rules, rule)
+			set.byName[rule.Name] = rule
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	sort.SliceStable(set.Rules, func(i, j int) bool {
+		return set.Rules[i].Priority > set.Rules[j].Priority
+	})
+	return set, nil
+}
+
+// lineError 带行号的配置错误
+type lineError struct {
+	line int
+	rule string
+	msg  string
+}
+
+func (e *lineError) Error() string {
+	return fmt.Sprintf("%d: 规则 %q: %s", e.line, e.rule, e.msg)
+}
+
+// parseRule 解析单条规则及其推送渠道配置
+func parseRule(key, value *yaml.Node) (*Rule, []error) {
+	rule := &Rule{Name: key.Value, line: key.Line}
+	if raw, err := yaml.Marshal(value); err == nil {
+		rule.fingerprint = string(raw)
+	}
+	errorf := func(line int, format string, args ...interface{}) error {
+		return &lineError{line: line, rule: rule.Name, msg: fmt.Sprintf(format, args...)}
+	}
+	if value.Kind != yaml.MappingNode {
+		return nil, []error{errorf(value.Line, "规则配置应为映射")}
+	}
+
+	// 先确定推送渠道，才能知道哪些配置项合法
+	var notifyNode *yaml.Node
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		if value.Content[i].Value == "notify" {
+			notifyNode = value.Content[i+1]
+		}
+	}
+	if notifyNode == nil {
+		return nil, []error{errorf(key.Line, "缺少 notify")}
+	}
+	factory, ok := notifierFactories[notifyNode.Value]
+	if !ok {
+		return nil, []error{errorf(notifyNode.Line, "未知的通知类型 %q，可选: %s", notifyNode.Value, strings.Join(NotifierNames(), ", "))}
+	}
+	rule.Notify = notifyNode.Value
+	rule.notifier = factory()
+
+	var errs []error
+	fields := yamlFields(reflect.ValueOf(rule).Elem())
+	for name, field := range yamlFields(reflect.ValueOf(rule.notifier).Elem()) {
+		fields[name] = field
+	}
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		k, v := value.Content[i], value.Content[i+1]
+		field, ok := fields[k.Value]
+		if !ok {
+			errs = append(errs, errorf(k.Line, "%s 不支持配置项 %s", rule.Notify, k.Value))
+			continue
+		}
+		if err := v.Decode(field.value.Addr().Interface()); err != nil {
+			var typeErr *yaml.TypeError
+			if errors.As(err, &typeErr) {
+				errs = append(errs, errorf(v.Line, "%s 类型错误，应为 %s", k.Value, typeName(field.value.Type())))
+			} else {
+				errs = append(errs, errorf(v.Line, "%s 配置错误: %v", k.Value, err))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if fields[name].required && fields[name].value.IsZero() {
+			errs = append(errs, errorf(key.Line, "缺少 %s", name))
+		}
+	}
+	if rule.Type == "" && rule.When != nil {
+		rule.Type = "all"
+	}
+	switch rule.Type {
+	case "":
+		errs = append(errs, errorf(key.Line, "缺少 type"))
+	case "all":
+	case "keyword":
+		if rule.Rule == "" {
+			errs = append(errs, errorf(key.Line, "keyword 规则缺少 rule"))
+		}
+	case "regex":
+		re, err := regexp.Compile(rule.Rule)
+		if err != nil {
+			errs = append(errs, errorf(key.Line, "正则表达式错误: %v", err))
+		}
+		rule.regex = re
+	case "expr":
+		prg, err := compileExpr(rule.Rule)
+		if err != nil {
+			errs = append(errs, errorf(key.Line, "表达式错误: %v", err))
+		}
+		rule.program = prg
+	default:
+		errs = append(errs, errorf(key.Line, "未知的规则类型 %q", rule.Type))
+	}
+	if rule.Template != "" {
+		tmpl, err := parseMessageTemplate("template", rule.Template)
+		if err != nil {
+			errs = append(errs, errorf(key.Line, "template 错误: %v", err))
+		}
+		rule.template = tmpl
+	}
+	if rule.TitleTemplate != "" {
+		tmpl, err := parseMessageTemplate("title_template", rule.TitleTemplate)
+		if err != nil {
+			errs = append(errs, errorf(key.Line, "title_template 错误: %v", err))
+		}
+		rule.titleTemplate = tmpl
+	}
+	if len(errs) == 0 {
+		if err := rule.notifier.Validate(); err != nil {
+			errs = append(errs, errorf(key.Line, "%s 配置错误: %v", rule.Notify, err))
+		}
+		if r, ok := rule.notifier.(templateRequirer); ok && rule.Template == "" {
+			if reason := r.requiresTemplate(); reason != "" {
+				errs = append(errs, errorf(key.Line, "%s 配置错误: %s", rule.Notify, reason))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return rule, nil
+}
+
+// configField 规则中的一个配置项
+type configField struct {
+	value    reflect.Value
+	field    reflect.StructField
+	required bool
+}
+
+// yamlFields 返回结构体中 yaml 标签 -> 字段，展开 ",inline" 的嵌入结构体
+func yamlFields(v reflect.Value) map[string]configField {
+	fields := map[string]configField{}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("yaml")
+		if !f.IsExported() || tag == "" || tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if opts == "inline" {
+			for k, sub := range yamlFields(v.Field(i)) {
+				fields[k] = sub
+			}
+			continue
+		}
+		fields[name] = configField{value: v.Field(i), field: f, required: f.Tag.Get("required") == "true"}
+	}
+	return fields
+}
+
+// typeName 配置项类型的中文说明，用于错误提示
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "字符串"
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return "整数"
+	case reflect.Float64:
+		return "数字"
+	case reflect.Bool:
+		return "布尔值"
+	case reflect.Slice:
+		return typeName(t.Elem()) + "列表"
+	case reflect.Map, reflect.Struct:
+		return "映射"
+	}
+	return t.String()
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRuleSet(t *testing.T) {
+	data := `
+bank:
+  type: keyword
+  rule: 银行
+  notify: email
+  smtp_host: smtp.qq.com
+  smtp_port: 465
+  username: a@qq.com
+  password: secret
+  from: a@qq.com
+  to: b@qq.com
+all:
+  type: all
+  notify: gotify
+  url: https://gotify.example.com
+  token: abc
+`
+	set, err := ParseRuleSet("forward.yaml", []byte(data))
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if len(set.Rules) != 2 || set.Rules[0].Name != "bank" || set.Rules[1].Name != "all" {
+		t.Fatalf("规则顺序应与文件一致: %+v", set.Rules)
+	}
+	// 未加引号的端口号也能解析为字符串
+	if n := set.Rules[0].notifier.(*EmailNotifier); n.SMTPPort != "465" {
+		t.Fatalf("smtp_port 解析错误: %q", n.SMTPPort)
+	}
+	if r, ok := set.Get("all"); !ok || !r.Match(&MatchInput{Text: "任意内容"}) {
+		t.Fatal("all 规则应匹配任意短信")
+	}
+}
+
+func TestParseRuleSetErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{
+			name: "未知通知类型",
+			data: "a:\n  type: all\n  notify: pigeon\n",
+			want: []string{`forward.yaml:3: 规则 "a": 未知的通知类型 "pigeon"`},
+		},
+		{
+			name: "缺少必填项",
+			data: "tg:\n  type: all\n  notify: telegram\n  bot_token: x\n",
+			want: []string{`forward.yaml:1: 规则 "tg": 缺少 chat_id`},
+		},
+		{
+			name: "正则错误",
+			data: "re:\n  type: regex\n  rule: \"(\"\n  notify: wechat\n  url: http://x\n",
+			want: []string{`forward.yaml:1: 规则 "re": 正则表达式错误`},
+		},
+		{
+			name: "类型错误与未知配置项",
+			data: "w:\n  type: all\n  notify: wechat\n  url: [a, b]\n  token: x\n",
+			want: []string{
+				`forward.yaml:4: 规则 "w": url 类型错误，应为 字符串`,
+				`forward.yaml:5: 规则 "w": wechat 不支持配置项 token`,
+			},
+		},
+		{
+			name: "多条规则的错误一起返回",
+			data: "a:\n  type: all\n  notify: wechat\nb:\n  type: fuzzy\n  notify: bark\n  url: http://x\n",
+			want: []string{
+				`forward.yaml:1: 规则 "a": 缺少 url`,
+				`forward.yaml:4: 规则 "b": 未知的规则类型 "fuzzy"`,
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := ParseRuleSet("forward.yaml", []byte(c.data))
+			if err == nil {
+				t.Fatal("应返回错误")
+			}
+			for _, want := range c.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("错误信息缺少 %q:\n%v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestExampleConfig(t *testing.T) {
+	if _, err := LoadRuleSet("../data/config/forward.yaml"); err != nil {
+		t.Fatalf("示例配置校验失败:\n%v", err)
+	}
+}
+
+func TestRuleSetSelect(t *testing.T) {
+	data := `
+all:
+  type: all
+  fallback: true
+  notify: bark
+  url: http://all
+log:
+  type: all
+  notify: bark
+  url: http://log
+bank:
+  type: keyword
+  rule: 银行
+  priority: 10
+  stop: true
+  notify: bark
+  url: http://bank
+code:
+  type: keyword
+  rule: 验证码
+  priority: 5
+  notify: bark
+  url: http://code
+`
+	set, err := ParseRuleSet("forward.yaml", []byte(data))
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	cases := []struct {
+		text string
+		want []string
+	}{
+		// bank 优先级最高且 stop，后面的规则不再匹配
+		{"银行验证码 1234", []string{"bank"}},
+		{"验证码 1234", []string{"code", "log"}},
+		{"你好", []string{"log"}},
+	}
+	for _, c := range cases {
+		var got []string
+		for _, r := range set.Select(func(r *Rule) bool { return r.Match(&MatchInput{Text: c.text}) }) {
+			got = append(got, r.Name)
+		}
+		if strings.Join(got, ",") != strings.Join(c.want, ",") {
+			t.Errorf("%q 命中 %v, 期望 %v", c.text, got, c.want)
+		}
+	}
+
+	// 普通规则都没命中时才使用兜底规则
+	got := set.Select(func(r *Rule) bool { return r.Fallback })
+	if len(got) != 1 || got[0].Name != "all" {
+		t.Fatalf("应命中兜底规则: %v", got)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DispatcherOptions 异步投递参数
+type DispatcherOptions struct {
+	Workers       int            // 并发投递的 worker 数量
+	QueueSize     int            // 内存中等待投递的任务上限，满了以后拒绝新的短信
+	ChannelLimits map[string]int // 各推送渠道的并发上限，如 email=1
+	SendTimeout   time.Duration  // 单次发送超时
+	Interval      time.Duration  // 扫描到期重试的间隔
+}
+
+// Dispatcher 从持久化队列取出投递记录，交给 worker 池异步发送
+type Dispatcher struct {
+	queue   *DeliveryQueue
+	deliver func(context.Context, *Delivery) error
+	opts    DispatcherOptions
+	jobs    chan *Delivery
+
+	mu       sync.Mutex
+	inflight map[uint64]bool          // 已提交但还未更新结果的记录，重试扫描不会重复领取
+	limits   map[string]*channelLimit // 有并发上限的渠道
+	parked   int                      // 等待渠道空闲的记录数
+}
+
+// channelLimit 渠道并发状态，达到上限的记录在 waiting 中排队，不占用 worker
+type channelLimit struct {
+	max     int
+	running int
+	waiting []*Delivery
+}
+
+// NewDispatcher 创建投递调度器，deliver 负责实际发送
+func NewDispatcher(queue *DeliveryQueue, deliver func(context.Context, *Delivery) error, opts DispatcherOptions) *Dispatcher {
+	limits := make(map[string]*channelLimit, len(opts.ChannelLimits))
+	for notify, n := range opts.ChannelLimits {
+		limits[notify] = &channelLimit{max: n}
+	}
+	return &Dispatcher{
+		queue:    queue,
+		deliver:  deliver,
+		opts:     opts,
+		jobs:     make(chan *Delivery, opts.QueueSize),
+		inflight: map[uint64]bool{},
+		limits:   limits,
+	}
+}
+
+// Start 启动 worker 池和重试扫描，直到 ctx 结束
+func (d *Dispatcher) Start(ctx context.Context) {
+	for i := 0; i < d.opts.Workers; i++ {
+		go d.worker(ctx)
+	}
+	go d.retryLoop(ctx)
+}
+
+// Busy 内存队列已满，调用方应拒绝新的请求，由上游稍后重试
+func (d *Dispatcher) Busy() bool {
+	return d.Queued() >= cap(d.jobs)
+}
+
+// Submit 提交一条已领取的投递记录，队列已满时释放记录交给重试扫描处理
+func (d *Dispatcher) Submit(del *Delivery) bool {
+	d.mu.Lock()
+	d.inflight[del.ID] = true
+	d.mu.Unlock()
+	select {
+	case d.jobs <- del:
+		return true
+	default:
+		d.mu.Lock()
+		delete(d.inflight, del.ID)
+		d.mu.Unlock()
+		if err := d.queue.Release(del); err != nil {
+			log.WithFields(log.Fields{"id": del.ID, "rule": del.Rule}).Errorf("释放投递记录失败: %v", err)
+		}
+		return false
+	}
+}
+
+// Queued 内存中等待发送的数量，包括等待渠道空闲的记录
+func (d *Dispatcher) Queued() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.jobs) + d.parked
+}
+
+// inFlight 记录已提交给 worker，还未写回投递结果
+func (d *Dispatcher) inFlight(id uint64) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.inflight[id]
+}
+
+func (d *Dispatcher) worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case del := <-d.jobs:
+			d.attempt(ctx, del)
+		}
+	}
+}
+
+// retryLoop 定期领取到期的重试
+func (d *Dispatcher) retryLoop(ctx context.Context) {
+	ticker := time.NewTicker(d.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			d.retryDue(now)
+		}
+	}
+}
+
+// retryDue 只领取内存队列剩余容量内的数量。排队等待过久的记录租约可能已经到期，
+// 但仍在本进程中，跳过它们避免重复发送
+func (d *Dispatcher) retryDue(now time.Time) {
+	free := cap(d.jobs) - d.Queued()
+	if free <= 0 {
+		return
+	}
+	due, err := d.queue.claimDue(now, free, d.inFlight)
+	if err != nil {
+		log.Errorf("读取投递队列失败: %v", err)
+		return
+	}
+	for _, del := range due {
+		d.Submit(del)
+	}
+}
+
+// attempt 在渠道并发上限内投递。渠道已满时记录进入该渠道的等待列表，worker 继续处理其他渠道，
+// 正在发送的 worker 完成后接着发送等待中的记录
+func (d *Dispatcher) attempt(ctx context.Context, del *Delivery) {
+	if !d.acquire(del) {
+		return
+	}
+	for del != nil && ctx.Err() == nil {
+		d.send(ctx, del)
+		del = d.release(del)
+	}
+}
+
+// acquire 占用渠道的并发名额，返回 false 表示已加入等待列表
+func (d *Dispatcher) acquire(del *Delivery) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	l, ok := d.limits[del.Notify]
+	if !ok {
+		return true
+	}
+	if l.running < l.max {
+		l.running++
+		return true
+	}
+	l.waiting = append(l.waiting, del)
+	d.parked++
+	return false
+}
+
+// release 发送结束后释放名额，有等待中的记录时把名额直接交给它并返回
+func (d *Dispatcher) release(del *Delivery) *Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.inflight, del.ID)
+	l, ok := d.limits[del.Notify]
+	if !ok {
+		return nil
+	}
+	if len(l.waiting) > 0 {
+		next := l.waiting[0]
+		l.waiting = l.waiting[1:]
+		d.parked--
+		return next
+	}
+	l.running--
+	return nil
+}
+
+// send 投递一次，并根据结果更新队列
+func (d *Dispatcher) send(ctx context.Context, del *Delivery) {
+	logger := log.WithFields(log.Fields{"id": del.ID, "rule": del.Rule, "notify": del.Notify, "attempt": del.Attempts + 1})
+	sendCtx, cancel := context.WithTimeout(ctx, d.opts.SendTimeout)
+	defer cancel()
+	if err := d.deliver(sendCtx, del); err != nil {
+		logger.Errorf("通知发送失败: %v", err)
+		if err := d.queue.Fail(del, err); err != nil {
+			logger.Errorf("更新投递记录失败: %v", err)
+		}
+		return
+	}
+	logger.Info("通知发送成功")
+	if err := d.queue.Complete(del); err != nil {
+		logger.Errorf("删除投递记录失败: %v", err)
+	}
+}
+
+// parseChannelLimits 解析渠道并发配置，格式如 email=1,telegram=2
+func parseChannelLimits(s string) (map[string]int, error) {
+	limits := map[string]int{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("格式错误: %s", item)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("并发数错误: %s", item)
+		}
+		limits[strings.TrimSpace(name)] = n
+	}
+	return limits, nil
+}
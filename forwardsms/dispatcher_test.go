@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitUntil 轮询等待条件成立，超时后测试失败
+func waitUntil(t *testing.T, msg string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDispatcherChannelLimit(t *testing.T) {
+	q, err := OpenDeliveryQueue(filepath.Join(t.TempDir(), "queue.db"), testQueueOptions())
+	if err != nil {
+		t.Fatalf("打开队列失败: %v", err)
+	}
+	defer q.Close()
+
+	var running, peak int32
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	wechat := make(chan struct{})
+	deliver := func(ctx context.Context, d *Delivery) error {
+		if d.Notify == "wechat" {
+			close(wechat)
+			return nil
+		}
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		started <- struct{}{}
+		<-unblock
+		return nil
+	}
+	// 只有 2 个 worker，等待 email 名额的记录不能占住 worker
+	d := NewDispatcher(q, deliver, DispatcherOptions{
+		Workers:       2,
+		QueueSize:     10,
+		ChannelLimits: map[string]int{"email": 1},
+		SendTimeout:   time.Minute,
+		Interval:      time.Hour,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.Start(ctx)
+
+	submit := func(notify string) {
+		del, err := q.Enqueue("rule", notify, &Message{})
+		if err != nil {
+			t.Fatalf("写入队列失败: %v", err)
+		}
+		if !d.Submit(del) {
+			t.Fatal("队列未满时提交不应失败")
+		}
+	}
+	for i := 0; i < 3; i++ {
+		submit("email")
+	}
+	<-started
+	submit("wechat")
+	select {
+	case <-wechat:
+	case <-time.After(5 * time.Second):
+		t.Fatal("email 达到并发上限时其他渠道不应被阻塞")
+	}
+
+	unblock <- struct{}{}
+	for i := 0; i < 2; i++ {
+		<-started
+		unblock <- struct{}{}
+	}
+	waitUntil(t, "投递成功后应从队列删除", func() bool { return q.Pending() == 0 })
+	if peak := atomic.LoadInt32(&peak); peak != 1 {
+		t.Fatalf("email 并发上限为 1, 实际峰值: %d", peak)
+	}
+	if n := d.Queued(); n != 0 {
+		t.Fatalf("全部发送后不应有等待中的记录: %d", n)
+	}
+}
+
+func TestDispatcherSkipsInFlight(t *testing.T) {
+	opts := testQueueOptions()
+	opts.Lease = time.Millisecond
+	q, err := OpenDeliveryQueue(filepath.Join(t.TempDir(), "queue.db"), opts)
+	if err != nil {
+		t.Fatalf("打开队列失败: %v", err)
+	}
+	defer q.Close()
+
+	var calls int32
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	deliver := func(ctx context.Context, d *Delivery) error {
+		atomic.AddInt32(&calls, 1)
+		close(started)
+		<-unblock
+		return nil
+	}
+	d := NewDispatcher(q, deliver, DispatcherOptions{Workers: 1, QueueSize: 10, SendTimeout: time.Minute, Interval: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.Start(ctx)
+
+	del, _ := q.Enqueue("rule", "wechat", &Message{})
+	d.Submit(del)
+	<-started
+	// 发送时间超过租约后，重试扫描不应再次领取同一条记录
+	d.retryDue(time.Now().Add(time.Hour))
+	if n := d.Queued(); n != 0 {
+		t.Fatalf("仍在发送的记录不应被重复领取: %d", n)
+	}
+	close(unblock)
+	waitUntil(t, "投递成功后应从队列删除", func() bool { return q.Pending() == 0 })
+	if calls := atomic.LoadInt32(&calls); calls != 1 {
+		t.Fatalf("应只发送一次, 实际: %d", calls)
+	}
+}
+
+func TestDispatcherBackpressure(t *testing.T) {
+	q, err := OpenDeliveryQueue(filepath.Join(t.TempDir(), "queue.db"), testQueueOptions())
+	if err != nil {
+		t.Fatalf("打开队列失败: %v", err)
+	}
+	defer q.Close()
+
+	// 不启动 worker，内存队列只能容纳 1 条
+	d := NewDispatcher(q, nil, DispatcherOptions{QueueSize: 1})
+	first, _ := q.Enqueue("a", "wechat", &Message{})
+	second, _ := q.Enqueue("b", "wechat", &Message{})
+	if !d.Submit(first) || !d.Busy() {
+		t.Fatal("第一条应提交成功且队列变满")
+	}
+	if d.Submit(second) {
+		t.Fatal("队列已满时提交应失败")
+	}
+	// 被拒绝的记录立即释放，重试扫描可以再次领取
+	due, _ := q.claimDue(time.Now(), 10, nil)
+	if len(due) != 1 || due[0].ID != second.ID {
+		t.Fatalf("被拒绝的记录应可被领取: %+v", due)
+	}
+}
+
+func TestParseChannelLimits(t *testing.T) {
+	limits, err := parseChannelLimits("email=1, telegram=2,")
+	if err != nil || limits["email"] != 1 || limits["telegram"] != 2 {
+		t.Fatalf("解析结果错误: %v, %v", limits, err)
+	}
+	if _, err := parseChannelLimits("email"); err == nil {
+		t.Fatal("缺少并发数应报错")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/ext"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	exprEnvOnce sync.Once
+	exprEnv     *cel.Env
+	exprEnvErr  error
+)
+
+// exprEnvironment 返回 type: expr 规则可以使用的变量和函数
+func exprEnvironment() (*cel.Env, error) {
+	exprEnvOnce.Do(func() {
+		exprEnv, exprEnvErr = cel.NewEnv(
+			cel.Variable("call", cel.BoolType),
+			cel.Variable("text", cel.StringType),
+			cel.Variable("sender", cel.StringType),
+			cel.Variable("number", cel.StringType),
+			cel.Variable("phone_id", cel.StringType),
+			cel.Variable("source", cel.StringType),
+			cel.Variable("sms_id", cel.StringType),
+			cel.Variable("name", cel.StringType),
+			cel.Variable("call_type", cel.StringType),
+			cel.Variable("duration", cel.IntType),
+			cel.Variable("time", cel.TimestampType),
+			cel.Variable("code", cel.StringType),
+			ext.Strings(),
+			// len 按字符计数，中文短信不会按字节翻倍
+			cel.Function("len",
+				cel.Overload("len_string", []*cel.Type{cel.StringType}, cel.IntType,
+					cel.UnaryBinding(func(v ref.Val) ref.Val {
+						return types.Int(utf8.RuneCountInString(string(v.(types.String))))
+					}),
+				),
+			),
+			// hour 返回本地时区的小时，CEL 自带的 getHours 默认为 UTC
+			cel.Function("hour",
+				cel.Overload("hour_timestamp", []*cel.Type{cel.TimestampType}, cel.IntType,
+					cel.UnaryBinding(func(v ref.Val) ref.Val {
+						return types.Int(v.(types.Timestamp).Time.In(time.Local).Hour())
+					}),
+				),
+			),
+		)
+	})
+	return exprEnv, exprEnvErr
+}
+
+// compileExpr 在加载配置时编译表达式，要求结果为布尔值
+func compileExpr(source string) (cel.Program, error) {
+	env, err := exprEnvironment()
+	if err != nil {
+		return nil, err
+	}
+	ast, iss := env.Compile(source)
+	if iss.Err() != nil {
+		return nil, iss.Err()
+	}
+	if ast.OutputType() != cel.BoolType {
+		return nil, fmt.Errorf("表达式结果应为布尔值，实际为 %s", ast.OutputType())
+	}
+	return env.Program(ast)
+}
+
+// evalExpr 对输入求值，运行时错误（如除零）视为不匹配
+func (r *Rule) evalExpr(in *MatchInput) bool {
+	out, _, err := r.program.Eval(map[string]interface{}{
+		"call":      in.Call,
+		"text":      in.Text,
+		"sender":    in.Number,
+		"number":    in.Number,
+		"phone_id":  in.PhoneID,
+		"source":    in.Source,
+		"sms_id":    in.SMSID,
+		"name":      in.Name,
+		"call_type": in.CallType,
+		"duration":  in.Duration,
+		"time":      in.Time,
+		"code":      detectVerificationCode(in.Text),
+	})
+	if err != nil {
+		log.WithField("rule", r.Name).Errorf("表达式求值失败: %v", err)
+		return false
+	}
+	matched, _ := out.Value().(bool)
+	return matched
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseExprRule(t *testing.T, expr string) *Rule {
+	t.Helper()
+	data := "r:\n  type: expr\n  rule: '" + expr + "'\n  notify: bark\n  url: http://x\n"
+	set, err := ParseRuleSet("forward.yaml", []byte(data))
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	rule, _ := set.Get("r")
+	return rule
+}
+
+func TestRuleExpr(t *testing.T) {
+	at := func(clock string) time.Time {
+		tm, _ := time.ParseInLocation("2006-01-02 15:04", "2024-01-01 "+clock, time.Local)
+		return tm
+	}
+	long := "您的验证码为 123456，5分钟内有效，请勿泄露给他人"
+	example := `sender.startsWith("106") && len(text) > 20 && hour(time) >= 9`
+	cases := []struct {
+		name string
+		expr string
+		in   MatchInput
+		want bool
+	}{
+		{"示例表达式命中", example, MatchInput{Text: long, Number: "1069001", Time: at("10:00")}, true},
+		{"时间不满足", example, MatchInput{Text: long, Number: "1069001", Time: at("08:59")}, false},
+		{"内容太短", example, MatchInput{Text: "验证码 1234", Number: "1069001", Time: at("10:00")}, false},
+		{"len 按字符计数", `len(text) == 3`, MatchInput{Text: "验证码"}, true},
+		{"提取验证码", `code == "123456"`, MatchInput{Text: long}, true},
+		{"非验证码短信没有 code", `code != ""`, MatchInput{Text: "您尾号1234的卡于10月1日消费2000元"}, false},
+		{"字符串扩展函数", `text.lowerAscii().contains("bank")`, MatchInput{Text: "Your BANK code"}, true},
+		{"phone_id", `phone_id in ["SMS1", "SMS2"]`, MatchInput{PhoneID: "SMS2"}, true},
+		{"来电", `call && call_type == "missed" && duration == 0`, MatchInput{Call: true, CallType: "missed"}, true},
+		{"短信不满足来电表达式", `call`, MatchInput{Text: "x"}, false},
+		{"运行时错误视为不匹配", `int(text) > 0`, MatchInput{Text: "abc"}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := parseExprRule(t, c.expr).Match(&c.in); got != c.want {
+				t.Fatalf("结果 %v, 期望 %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestRuleExprErrors(t *testing.T) {
+	for _, expr := range []string{
+		``,
+		`sender.startsWith(`,
+		`unknown == 1`,
+		`len(text)`,
+	} {
+		data := "bad:\n  type: expr\n  rule: '" + expr + "'\n  notify: bark\n  url: http://x\n"
+		_, err := ParseRuleSet("forward.yaml", []byte(data))
+		if err == nil {
+			t.Errorf("应返回错误: %s", expr)
+			continue
+		}
+		if !strings.Contains(err.Error(), `规则 "bad"`) || !strings.Contains(err.Error(), "表达式错误") {
+			t.Errorf("错误信息应包含规则名称: %v", err)
+		}
+	}
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
-	"regexp"
-	"strings"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -14,15 +16,16 @@ import (
 )
 
 var (
-	viperconfig *viper.Viper
-	config      = map[string]interface{}{}
-	router      *gin.Engine
-	lastSMSID   string
+	viperconfig   *viper.Viper
+	router        *gin.Engine
+	lastSMSID     string
+	deliveryQueue *DeliveryQueue
+	dispatcher    *Dispatcher
 )
 
 // SMSRequest 接收来自 gammu-smsd 的请求结构
 type SMSRequest struct {
-	Secret    string `json:"secret"`
+	Secret    string `json:"secret,omitempty"`
 	Number    string `json:"number"`
 	Time      string `json:"time"`
 	Text      string `json:"text"`
@@ -56,6 +59,18 @@ type Config struct {
 }
 
 func main() {
+	printSchema := flag.Bool("schema", false, "输出 forward.yaml 的 JSON Schema 后退出")
+	flag.Parse()
+	if *printSchema {
+		schema, err := GenerateSchema()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(schema)
+		return
+	}
+
 	// 初始化日志
 	log.SetFormatter(&log.JSONFormatter{})
 	log.Info("启动短信转发服务...")
@@ -65,6 +80,11 @@ func main() {
 		log.Fatalf("初始化配置失败: %v", err)
 	}
 
+	// 初始化投递队列
+	if err := initQueue(); err != nil {
+		log.Fatalf("初始化投递队列失败: %v", err)
+	}
+
 	// 初始化 Gin
 	initGin()
 
@@ -81,13 +101,69 @@ func initConfig() error {
 	if err := viperconfig.ReadInConfig(); err != nil {
 		return fmt.Errorf("读取推送配置失败: %v", err)
 	}
-	if err := viperconfig.Unmarshal(&config); err != nil {
-		return fmt.Errorf("解析推送配置失败: %v", err)
+	loaded, err := LoadRuleSet(viperconfig.ConfigFileUsed())
+	if err != nil {
+		return fmt.Errorf("解析推送配置失败:\n%v", err)
 	}
-	log.Info("读取推送配置完成")
+	setRules(loaded)
+	log.Infof("读取推送配置完成，共 %d 条规则", len(loaded.Rules))
+	watchConfig(viperconfig.ConfigFileUsed())
 	return nil
 }
 
+func initQueue() error {
+	path := os.Getenv("QUEUE_DB")
+	if path == "" {
+		path = "/data/queue/forwardsms.db"
+	}
+	queue, err := OpenDeliveryQueue(path, QueueOptions{
+		MaxAttempts: envInt("QUEUE_MAX_ATTEMPTS", 10),
+		RetryBase:   envDuration("QUEUE_RETRY_BASE", 10*time.Second),
+		RetryMax:    envDuration("QUEUE_RETRY_MAX", 30*time.Minute),
+		Lease:       10 * time.Minute,
+	})
+	if err != nil {
+		return err
+	}
+	limits, err := parseChannelLimits(os.Getenv("CHANNEL_CONCURRENCY"))
+	if err != nil {
+		return fmt.Errorf("解析 CHANNEL_CONCURRENCY 失败: %v", err)
+	}
+	deliveryQueue = queue
+	dispatcher = NewDispatcher(queue, deliver, DispatcherOptions{
+		Workers:       envInt("WORKER_COUNT", 4),
+		QueueSize:     envInt("DISPATCH_QUEUE_SIZE", 100),
+		ChannelLimits: limits,
+		SendTimeout:   envDuration("SEND_TIMEOUT", time.Minute),
+		Interval:      5 * time.Second,
+	})
+	dispatcher.Start(context.Background())
+	log.Infof("投递队列已就绪: %s, 待投递: %d", path, deliveryQueue.Pending())
+	return nil
+}
+
+// envInt 读取整数环境变量，未设置或格式错误时返回默认值
+func envInt(key string, def int) int {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+		log.Warnf("环境变量 %s 格式错误: %s，使用默认值 %d", key, v, def)
+	}
+	return def
+}
+
+// envDuration 读取时长环境变量（如 10s、5m），未设置或格式错误时返回默认值
+func envDuration(key string, def time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+		log.Warnf("环境变量 %s 格式错误: %s，使用默认值 %s", key, v, def)
+	}
+	return def
+}
+
 func initGin() {
 	// 设置 Gin 模式
 	if os.Getenv("DEBUG") == "true" || os.Getenv("DEBUG") == "true" {
@@ -121,6 +197,13 @@ func setupRoutes() {
 		v1.GET("/health", healthHandler)
 		v1.GET("/status", statusHandler)
 		v1.POST("/test", testHandler)
+
+		// 死信查询与重放
+		deliveries := v1.Group("/deliveries", adminAuthMiddleware())
+		deliveries.GET("/failed", failedDeliveriesHandler)
+		deliveries.POST("/failed/replay", replayDeliveriesHandler)
+		deliveries.POST("/failed/:id/replay", replayDeliveriesHandler)
+		deliveries.GET("/receipts", receiptsHandler)
 	}
 
 	// 根路径重定向到健康检查
@@ -146,6 +229,28 @@ func CORSMiddleware() gin.HandlerFunc {
 	}
 }
 
+// adminAuthMiddleware 管理接口认证，需通过 X-Forward-Secret 请求头传入 FORWARD_SECRET。
+// 死信中包含短信内容，重放会再次发送通知，未配置 FORWARD_SECRET 时禁用管理接口
+func adminAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if os.Getenv("FORWARD_SECRET") == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"status":  "error",
+				"message": "未配置 FORWARD_SECRET，管理接口已禁用",
+			})
+			return
+		}
+		if err := validateSecret(c.GetHeader("X-Forward-Secret")); err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"status":  "error",
+				"message": "认证失败",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
 func startHTTPServer() {
 	port := os.Getenv("HTTP_PORT")
 	if port == "" {
@@ -171,16 +276,60 @@ func healthHandler(c *gin.Context) {
 
 // statusHandler 服务状态端点
 func statusHandler(c *gin.Context) {
-	configCount := len(config)
+	rules := currentRules()
+	reloadError, _ := lastReloadError.Load().(string)
 
 	c.JSON(http.StatusOK, gin.H{
 		"status":            "running",
 		"last_processed_id": lastSMSID,
-		"rule_count":        configCount,
+		"rule_count":        len(rules.Rules),
+		"config_version":    rules.Version,
+		"config_loaded_at":  rules.LoadedAt.Format(time.RFC3339),
+		"config_checksum":   rules.Checksum,
+		"config_error":      reloadError,
+		"pending_count":     pendingCount(),
+		"failed_count":      failedCount(),
+		"queued_count":      queuedCount(),
 		"timestamp":         time.Now().Format(time.RFC3339),
 	})
 }
 
+// pendingCount 队列中待投递的数量
+func pendingCount() int {
+	if deliveryQueue == nil {
+		return 0
+	}
+	return deliveryQueue.Pending()
+}
+
+// failedCount 死信数量
+func failedCount() int {
+	if deliveryQueue == nil {
+		return 0
+	}
+	return deliveryQueue.FailedCount()
+}
+
+// queuedCount 内存中等待 worker 发送的数量
+func queuedCount() int {
+	if dispatcher == nil {
+		return 0
+	}
+	return dispatcher.Queued()
+}
+
+// rejectIfBusy 投递队列已满时返回 503，gammu-smsd 会保留短信稍后重试
+func rejectIfBusy(c *gin.Context) bool {
+	if dispatcher == nil || !dispatcher.Busy() {
+		return false
+	}
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"status":  "error",
+		"message": "投递队列已满，请稍后重试",
+	})
+	return true
+}
+
 // testHandler 测试端点
 func testHandler(c *gin.Context) {
 	var testReq struct {
@@ -203,6 +352,9 @@ func testHandler(c *gin.Context) {
 		})
 		return
 	}
+	if rejectIfBusy(c) {
+		return
+	}
 
 	// 使用测试数据处理短信
 	if err := processSMS(testReq.Number, time.Now().Format("2006-01-02 15:04:05"), testReq.Text, smsReq); err != nil {
@@ -219,6 +371,67 @@ func testHandler(c *gin.Context) {
 	})
 }
 
+// failedDeliveriesHandler 列出重试耗尽的投递
+func failedDeliveriesHandler(c *gin.Context) {
+	if deliveryQueue == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "error", "message": "投递队列未启用"})
+		return
+	}
+	failed, err := deliveryQueue.Failed()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"count":  len(failed),
+		"data":   failed,
+	})
+}
+
+// replayDeliveriesHandler 重放死信，路径带 id 时只重放该条，否则重放全部
+func replayDeliveriesHandler(c *gin.Context) {
+	if deliveryQueue == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "error", "message": "投递队列未启用"})
+		return
+	}
+	var ids []uint64
+	if idParam := c.Param("id"); idParam != "" {
+		id, err := strconv.ParseUint(idParam, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "无效的投递 ID: " + idParam})
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	replayed, err := deliveryQueue.Replay(ids...)
+	if errors.Is(err, errDeliveryNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+	log.Infof("重放死信 %d 条", replayed)
+	c.JSON(http.StatusOK, gin.H{
+		"status":   "success",
+		"message":  "已重新加入投递队列",
+		"replayed": replayed,
+	})
+}
+
+// receiptsHandler 列出 Pushover 紧急通知的回执及确认状态
+func receiptsHandler(c *gin.Context) {
+	receipts := pushoverReceipts.List()
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"count":  len(receipts),
+		"data":   receipts,
+	})
+}
+
 // smsHandler 处理来自 gammu-smsd 的短信推送
 func smsHandler(c *gin.Context) {
 	var smsReq SMSRequest
@@ -238,6 +451,9 @@ func smsHandler(c *gin.Context) {
 		})
 		return
 	}
+	if rejectIfBusy(c) {
+		return
+	}
 	lastSMSID = smsReq.SMSID
 	log.WithFields(log.Fields{
 		"number":   smsReq.Number,
@@ -259,12 +475,12 @@ func smsHandler(c *gin.Context) {
 	// 返回成功响应
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
-		"message": "短信接收并处理成功",
+		"message": "短信接收成功，已加入投递队列",
 	})
 }
 
 type CallRequest struct {
-	Secret    string `json:"secret"`
+	Secret    string `json:"secret,omitempty"`
 	Number    string `json:"number"`
 	Name      string `json:"name"`
 	Time      string `json:"time"`
@@ -294,6 +510,9 @@ func callHandler(c *gin.Context) {
 		})
 		return
 	}
+	if rejectIfBusy(c) {
+		return
+	}
 	log.WithFields(log.Fields{
 		"number":   callReq.Number,
 		"name":     callReq.Name,
@@ -316,7 +535,7 @@ func callHandler(c *gin.Context) {
 	// 返回成功响应
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
-		"message": "call接收并处理成功",
+		"message": "call接收成功，已加入投递队列",
 	})
 }
 
@@ -335,53 +554,32 @@ func processSMS(sender, time, text string, smsReq SMSRequest) error {
 		"text":   text,
 	}).Info("开始处理短信")
 
-	// 遍历所有配置的转发规则
-	for name, cfg := range config {
-		c, ok := cfg.(map[string]interface{})
-		if !ok {
-			log.Warnf("配置格式错误: %s", name)
-			continue
-		}
-
-		rule, ok := c["rule"].(string)
-		if !ok {
-			log.Warnf("规则配置错误: %s", name)
-			continue
-		}
-
-		ruleType, ok := c["type"].(string)
-		if !ok {
-			log.Warnf("类型配置错误: %s", name)
-			continue
-		}
-
-		// 根据规则类型匹配
-		if shouldSendNotification(ruleType, rule, text) {
-			log.Infof("触发规则: %s, 类型: %s", name, ruleType)
-			sendNotification(c, sender, time, text, rule, smsReq)
-		}
+	// 按优先级遍历转发规则
+	in := &MatchInput{
+		Text:    text,
+		Number:  sender,
+		PhoneID: smsReq.PhoneID,
+		Time:    parseEventTime(time),
+		Source:  smsReq.Source,
+		SMSID:   smsReq.SMSID,
 	}
-
-	return nil
-}
-
-func shouldSendNotification(ruleType, rule, text string) bool {
-	switch ruleType {
-	case "all":
-		return true
-	case "keyword":
-		return strings.Contains(text, rule)
-	case "regex":
-		matched, err := regexp.MatchString(rule, text)
-		if err != nil {
-			log.Errorf("正则表达式错误: %v", err)
-			return false
+	matched := currentRules().Select(func(rule *Rule) bool {
+		return rule.Match(in)
+	})
+	// 某条规则写入队列失败时继续处理其余规则，再返回错误让 gammu-smsd 重新推送；
+	// 重新推送时已写入的规则会再发送一次，重复通知好过丢失短信
+	var errs []error
+	for _, rule := range matched {
+		log.Infof("触发规则: %s, 类型: %s", rule.Name, rule.Type)
+		if err := sendNotification(rule, sender, time, text, smsReq); err != nil {
+			errs = append(errs, err)
 		}
-		return matched
-	default:
-		log.Warnf("未知的规则类型: %s", ruleType)
-		return false
 	}
+	if len(matched) == 0 {
+		log.Info("没有命中任何规则")
+	}
+
+	return errors.Join(errs...)
 }
 
 func processCALL(callReq CallRequest) error {
@@ -393,28 +591,37 @@ func processCALL(callReq CallRequest) error {
 		"duration": callReq.Duration,
 	}).Info("开始处理call")
 
-	// 遍历所有配置的转发规则
-	for name, cfg := range config {
-		c, ok := cfg.(map[string]interface{})
-		if !ok {
-			log.Warnf("call配置格式错误: %s", name)
+	// 来电不按短信内容匹配，发送到其他条件满足的普通规则，stop 不生效；没有普通规则命中时发送到兜底规则
+	in := &MatchInput{
+		Call:     true,
+		Number:   callReq.Number,
+		PhoneID:  callReq.PhoneID,
+		Time:     parseEventTime(callReq.Time),
+		Source:   callReq.Source,
+		Name:     callReq.Name,
+		CallType: callReq.Type,
+		Duration: callReq.Duration,
+	}
+	var targets, fallbacks []*Rule
+	for _, rule := range currentRules().Rules {
+		if !rule.Match(in) {
 			continue
 		}
-
-		rule, ok := c["rule"].(string)
-		if !ok && rule != "all" {
-			log.Warnf("call规则配置错误: %s", name)
-			continue
+		if rule.Fallback {
+			fallbacks = append(fallbacks, rule)
+		} else {
+			targets = append(targets, rule)
 		}
-
-		ruleType, ok := c["type"].(string)
-		if !ok && ruleType != "all" {
-			log.Warnf("call类型配置错误: %s", name)
-			continue
+	}
+	if len(targets) == 0 {
+		targets = fallbacks
+	}
+	var errs []error
+	for _, rule := range targets {
+		if err := sendCallNotification(rule, callReq); err != nil {
+			errs = append(errs, err)
 		}
-		// 根据规则类型匹配
-		sendCallNotification(c, rule, callReq)
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// MatchInput 规则匹配的输入，短信和来电共用
+type MatchInput struct {
+	Call     bool      // 来电，没有内容，内容条件不参与匹配
+	Text     string    // 短信内容
+	Number   string    // 发送人或来电号码
+	PhoneID  string    // 接收的 SIM 卡标识
+	Time     time.Time // 接收时间
+	Source   string    // 来源，如 gammu-smsd
+	SMSID    string    // 短信 ID
+	Name     string    // 来电联系人名称
+	CallType string    // 来电类型，如 incoming/missed
+	Duration int       // 通话时长（秒）
+}
+
+// StringMatcher 号码、phone_id 等字段的匹配条件，exact/prefix/regex 任意一项命中即可。
+// 配置中可以简写为单个字符串或字符串列表，等同于 exact
+type StringMatcher struct {
+	Exact  []string `yaml:"exact" doc:"完全相等，任意一个即可"`
+	Prefix []string `yaml:"prefix" doc:"前缀，任意一个即可"`
+	Regex  string   `yaml:"regex" doc:"正则表达式"`
+
+	regex *regexp.Regexp
+}
+
+// UnmarshalYAML 支持字符串、字符串列表和完整映射三种写法，并预先编译正则
+func (m *StringMatcher) UnmarshalYAML(value *yaml.Node) error {
+	switch value.Kind {
+	case yaml.ScalarNode:
+		m.Exact = []string{value.Value}
+		return nil
+	case yaml.SequenceNode:
+		return value.Decode(&m.Exact)
+	}
+	type plain StringMatcher
+	if err := value.Decode((*plain)(m)); err != nil {
+		return err
+	}
+	if m.Regex != "" {
+		re, err := regexp.Compile(m.Regex)
+		if err != nil {
+			return fmt.Errorf("正则表达式错误: %v", err)
+		}
+		m.regex = re
+	}
+	if len(m.Exact) == 0 && len(m.Prefix) == 0 && m.regex == nil {
+		return fmt.Errorf("至少需要 exact、prefix、regex 中的一项")
+	}
+	return nil
+}
+
+// JSONSchema 对应 UnmarshalYAML 支持的三种写法
+func (StringMatcher) JSONSchema() map[string]interface{} {
+	props, _ := schemaProperties(reflect.TypeOf(StringMatcher{}))
+	return map[string]interface{}{
+		"oneOf": []interface{}{
+			map[string]interface{}{"type": "string"},
+			map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			map[string]interface{}{"type": "object", "properties": props, "additionalProperties": false},
+		},
+	}
+}
+
+// Match 判断任意一个候选值是否命中，nil 表示不限制
+func (m *StringMatcher) Match(values ...string) bool {
+	if m == nil {
+		return true
+	}
+	for _, v := range values {
+		for _, exact := range m.Exact {
+			if v == exact {
+				return true
+			}
+		}
+		for _, prefix := range m.Prefix {
+			if strings.HasPrefix(v, prefix) {
+				return true
+			}
+		}
+		if m.regex != nil && m.regex.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// numberVariants 号码的候选写法，+8613800000000 同时按 13800000000 匹配
+func numberVariants(number string) []string {
+	variants := []string{number}
+	for _, prefix := range []string{"+86", "0086"} {
+		if trimmed := strings.TrimPrefix(number, prefix); trimmed != number {
+			variants = append(variants, trimmed)
+		}
+	}
+	return variants
+}
+
+// Match 判断是否命中规则：内容、号码、phone_id 和 when 条件同时满足。
+// 来电不检查 keyword/regex 内容条件，expr 表达式可以通过 call 变量自行区分
+func (r *Rule) Match(in *MatchInput) bool {
+	if r.Type == "expr" {
+		if !r.evalExpr(in) {
+			return false
+		}
+	} else if !in.Call && !r.matchText(in.Text) {
+		return false
+	}
+	return r.Number.Match(numberVariants(in.Number)...) && r.PhoneID.Match(in.PhoneID) && r.When.Eval(in)
+}
+
+// matchText 按 type 匹配短信内容
+func (r *Rule) matchText(text string) bool {
+	switch r.Type {
+	case "all":
+		return true
+	case "keyword":
+		return strings.Contains(text, r.Rule)
+	case "regex":
+		return r.regex.MatchString(text)
+	}
+	return false
+}
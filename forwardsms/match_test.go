@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRuleMatchNumber(t *testing.T) {
+	data := `
+finance:
+  type: all
+  number: "95588"
+  notify: bark
+  url: http://finance
+ops:
+  type: keyword
+  rule: 告警
+  number:
+    prefix: ["106"]
+  phone_id: [SMS1, SMS2]
+  notify: bark
+  url: http://ops
+regex:
+  type: all
+  number:
+    regex: ^1069\d+$
+  notify: bark
+  url: http://regex
+`
+	set, err := ParseRuleSet("forward.yaml", []byte(data))
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	finance, _ := set.Get("finance")
+	ops, _ := set.Get("ops")
+	regex, _ := set.Get("regex")
+
+	cases := []struct {
+		rule *Rule
+		in   MatchInput
+		want bool
+	}{
+		{finance, MatchInput{Number: "95588", Text: "余额变动"}, true},
+		{finance, MatchInput{Number: "955880", Text: "余额变动"}, false},
+		{ops, MatchInput{Number: "10690001", PhoneID: "SMS1", Text: "服务告警"}, true},
+		{ops, MatchInput{Number: "+8610690001", PhoneID: "SMS2", Text: "服务告警"}, true},
+		{ops, MatchInput{Number: "10690001", PhoneID: "SMS3", Text: "服务告警"}, false},
+		{ops, MatchInput{Number: "10690001", PhoneID: "SMS1", Text: "普通通知"}, false},
+		{ops, MatchInput{Number: "13800000000", PhoneID: "SMS1", Text: "服务告警"}, false},
+		{regex, MatchInput{Number: "106912345"}, true},
+		{regex, MatchInput{Number: "1069abc"}, false},
+	}
+	for _, c := range cases {
+		if got := c.rule.Match(&c.in); got != c.want {
+			t.Errorf("规则 %s 匹配 %+v = %v, 期望 %v", c.rule.Name, c.in, got, c.want)
+		}
+	}
+
+	// 来电只检查号码和 phone_id
+	if !ops.Match(&MatchInput{Call: true, Number: "1065", PhoneID: "SMS1"}) {
+		t.Error("来电应忽略内容条件")
+	}
+}
+
+func TestStringMatcherErrors(t *testing.T) {
+	for _, data := range []string{
+		"a:\n  type: all\n  number:\n    regex: \"(\"\n  notify: bark\n  url: http://x\n",
+		"a:\n  type: all\n  number: {}\n  notify: bark\n  url: http://x\n",
+	} {
+		if _, err := ParseRuleSet("forward.yaml", []byte(data)); err == nil {
+			t.Errorf("应返回错误:\n%s", data)
+		}
+	}
+}
@@ -1,8 +1,14 @@
 package main
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/gin-gonic/gin"
 	"github.com/spf13/viper"
 )
 
@@ -19,9 +25,11 @@ func TestInitConfig(t *testing.T) {
 	if err := viperconfig.ReadInConfig(); err != nil {
 		t.Fatalf("读取推送配置失败: %v", err)
 	}
-	if err := viperconfig.Unmarshal(&config); err != nil {
+	loaded, err := LoadRuleSet(viperconfig.ConfigFileUsed())
+	if err != nil {
 		t.Fatalf("解析推送配置失败: %v", err)
 	}
+	setRules(loaded)
 	t.Log("读取推送配置完成")
 }
 
@@ -39,3 +47,88 @@ func TestSendNotification(t *testing.T) {
 		t.Fatalf("推送错误 %s", err.Error())
 	}
 }
+
+func TestEnqueueFailureReturnsError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "forward.yaml")
+	if err := os.WriteFile(path, []byte("a:\n  type: all\n  notify: bark\n  url: http://a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	set, err := LoadRuleSet(path)
+	if err != nil {
+		t.Fatalf("加载失败: %v", err)
+	}
+	old := currentRules()
+	defer activeRules.Store(old)
+	setRules(set)
+
+	q, err := OpenDeliveryQueue(filepath.Join(t.TempDir(), "queue.db"), testQueueOptions())
+	if err != nil {
+		t.Fatalf("打开队列失败: %v", err)
+	}
+	oldQueue, oldDispatcher := deliveryQueue, dispatcher
+	defer func() { deliveryQueue, dispatcher = oldQueue, oldDispatcher }()
+	deliveryQueue = q
+	dispatcher = NewDispatcher(q, nil, DispatcherOptions{QueueSize: 10})
+	// 关闭数据库模拟磁盘写入失败
+	q.Close()
+
+	if err := processCALL(CallRequest{Number: "10086", Type: "missed"}); err == nil {
+		t.Fatal("来电写入队列失败时应返回错误")
+	}
+	t.Setenv("FORWARD_SECRET", "")
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/sms", strings.NewReader(`{"number":"10086","text":"hello"}`))
+	smsHandler(c)
+	// 返回 5xx 时 gammu-smsd 保留短信文件，稍后重新推送
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("写入队列失败时应返回 500, 实际: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestExtractVerificationCode(t *testing.T) {
+	cases := []struct {
+		text string
+		want string
+	}{
+		// 模式1 的第一个分组是关键字，曾经返回 "验证码"
+		{"【某银行】您的验证码：123456，5分钟内有效", "123456"},
+		{"动态码 8 8 6 6，请勿泄露", "8866"},
+		{"Your CODE: A1b2C3", "A1b2C3"},
+		{"请输入（654321）完成登录", "654321"},
+		{"尾号1234的卡消费100元", "1234"},
+		{"没有数字", ""},
+	}
+	for _, c := range cases {
+		if got := extractVerificationCode(c.text); got != c.want {
+			t.Errorf("extractVerificationCode(%q) = %q, want %q", c.text, got, c.want)
+		}
+	}
+}
+
+func TestDetectVerificationCode(t *testing.T) {
+	cases := []struct {
+		text string
+		want string
+	}{
+		{"【某银行】您的验证码：123456，5分钟内有效", "123456"},
+		{"Your verification code is 4321", "4321"},
+		// 没有验证码关键字时，卡号尾号、金额、日期等数字都不是验证码
+		{"您尾号1234的卡于10月1日消费2000元", ""},
+		{"订单 202510 已发货", ""},
+	}
+	for _, c := range cases {
+		if got := detectVerificationCode(c.text); got != c.want {
+			t.Errorf("detectVerificationCode(%q) = %q, want %q", c.text, got, c.want)
+		}
+		// 队列中旧版本保存的 Code 不再使用
+		d := &MessageData{Text: c.text, Code: "999999"}
+		if got := d.verificationCode(); got != c.want {
+			t.Errorf("verificationCode(%q) = %q, want %q", c.text, got, c.want)
+		}
+	}
+	if code := (&MessageData{Call: true, Text: "验证码 123456"}).verificationCode(); code != "" {
+		t.Errorf("来电不应有验证码: %q", code)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Message 推送消息
+type Message struct {
+	Title       string `json:"title"`        // 标题，如 短信通知/来电通知
+	MobileTitle string `json:"mobile_title"` // 移动端推送标题，短信为发送人号码
+	Content     string `json:"content"`      // 完整消息内容
+	Brief       string `json:"brief"`        // 移动端精简内容 (bark/gotify)
+
+	Body string       `json:"body,omitempty"` // 富文本格式的正文，默认为短信内容，配置了 template 时为模板内容
+	Data *MessageData `json:"data,omitempty"` // 原始字段，富文本格式按字段分开展示
+}
+
+// Notifier 推送渠道
+type Notifier interface {
+	// Validate 校验必填项以外的渠道配置，如端口、地址格式
+	Validate() error
+	// Send 发送消息，失败时返回错误
+	Send(ctx context.Context, msg *Message) error
+}
+
+// templateRequirer 部分配置只适用于自定义 template 的渠道实现，返回不为空时表示规则必须配置 template
+type templateRequirer interface {
+	requiresTemplate() string
+}
+
+// NotifierFactory 创建一个空的推送渠道，配置项由 yaml 标签从规则中解析填充。
+// 标记 required:"true" 的字段在加载时检查，doc 标签用于生成 JSON Schema
+type NotifierFactory func() Notifier
+
+var notifierFactories = map[string]NotifierFactory{}
+
+// RegisterNotifier 注册推送渠道，各渠道在自己的 init 中调用
+func RegisterNotifier(name string, factory NotifierFactory) {
+	if _, ok := notifierFactories[name]; ok {
+		panic(fmt.Sprintf("推送渠道重复注册: %s", name))
+	}
+	notifierFactories[name] = factory
+}
+
+// NotifierNames 返回已注册的推送渠道名称
+func NotifierNames() []string {
+	names := make([]string, 0, len(notifierFactories))
+	for name := range notifierFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkEnum 校验可选值配置项，空值表示使用默认值
+func checkEnum(name, value string, allowed ...string) error {
+	if value == "" {
+		return nil
+	}
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s 应为 %s 之一，实际为 %q", name, strings.Join(allowed, ", "), value)
+}
+
+// HTTPError 推送接口返回了非 2xx 状态码
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("状态码: %d, 响应: %s", e.StatusCode, e.Body)
+}
+
+// newHTTPClient 创建 HTTP 客户端，proxy 不为空时通过代理发送（已在 Validate 中校验格式）
+func newHTTPClient(timeout time.Duration, proxy string) *http.Client {
+	client := &http.Client{Timeout: timeout}
+	if proxy != "" {
+		proxyURL, _ := url.Parse(proxy)
+		client.Transport = &http.Transport{
+			Proxy: http.ProxyURL(proxyURL),
+		}
+	}
+	return client
+}
+
+// validateProxy 校验代理地址格式
+func validateProxy(proxy string) error {
+	if proxy == "" {
+		return nil
+	}
+	if _, err := url.Parse(proxy); err != nil {
+		return fmt.Errorf("解析代理URL失败: %v", err)
+	}
+	return nil
+}
+
+// postJSON 以 JSON 格式 POST 数据并返回响应内容，非 2xx 状态码返回 *HTTPError
+func postJSON(ctx context.Context, client *http.Client, url string, payload interface{}) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求失败: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doRequest(client, req)
+}
+
+// doRequest 发送请求并读取响应，非 2xx 状态码返回 *HTTPError
+func doRequest(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %v", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return body, &HTTPError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return body, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	RegisterNotifier("bark", func() Notifier { return &BarkNotifier{} })
+}
+
+// BarkRequest Bark请求参数
+type BarkRequest struct {
+	Title     string `json:"title"`
+	Body      string `json:"body"`
+	IsArchive int    `json:"isArchive,omitempty"`
+	Group     string `json:"group,omitempty"`
+	Icon      string `json:"icon,omitempty"`
+	Level     string `json:"level,omitempty"`
+	Sound     string `json:"sound,omitempty"`
+	Badge     string `json:"badge,omitempty"`
+	URL       string `json:"url,omitempty"`
+	Call      string `json:"call,omitempty"`
+	Copy      string `json:"copy,omitempty"`
+	AutoCopy  int    `json:"autoCopy,omitempty"`
+}
+
+// BarkNotifier Bark 推送
+type BarkNotifier struct {
+	URL string `yaml:"url" required:"true" doc:"Bark 推送地址，如 https://api.day.app/your_key"`
+}
+
+func (n *BarkNotifier) Validate() error {
+	return nil
+}
+
+func (n *BarkNotifier) Send(ctx context.Context, msg *Message) error {
+	// 构建请求参数
+	msgMap := BarkRequest{
+		Title:     msg.MobileTitle,
+		Body:      msg.Brief,
+		IsArchive: 1,
+	}
+
+	// 检测验证码模式并提取验证码
+	if code := detectVerificationCode(msg.Brief); code != "" {
+		msgMap.Copy = code
+		msgMap.AutoCopy = 1
+		log.Infof("检测到验证码: %s", code)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	_, err := postJSON(ctx, client, n.URL, msgMap)
+	return err
+}
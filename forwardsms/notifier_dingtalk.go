@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+func init() {
+	RegisterNotifier("dingtalk", func() Notifier { return &DingtalkNotifier{} })
+}
+
+// DingtalkRequest 钉钉机器人请求结构
+type DingtalkRequest struct {
+	MsgType string `json:"msgtype"`
+	Text    *struct {
+		Content string `json:"content"`
+	} `json:"text,omitempty"`
+	Markdown   *DingtalkMarkdown   `json:"markdown,omitempty"`
+	ActionCard *DingtalkActionCard `json:"actionCard,omitempty"`
+	At         struct {
+		IsAtAll bool `json:"isAtAll"`
+	} `json:"at"`
+}
+
+// DingtalkMarkdown 钉钉 markdown 消息，title 显示在会话列表中
+type DingtalkMarkdown struct {
+	Title string `json:"title"`
+	Text  string `json:"text"`
+}
+
+// DingtalkActionCard 钉钉整体跳转的 actionCard 消息
+type DingtalkActionCard struct {
+	Title       string `json:"title"`
+	Text        string `json:"text"`
+	SingleTitle string `json:"singleTitle"`
+	SingleURL   string `json:"singleURL"`
+}
+
+// DingtalkNotifier 钉钉群机器人
+type DingtalkNotifier struct {
+	URL       string `yaml:"url" required:"true" doc:"钉钉群机器人 webhook 地址"`
+	Format    string `yaml:"format" enum:"text,markdown,action_card" default:"text" doc:"消息格式: text 纯文本, markdown, action_card 带跳转按钮的卡片"`
+	ActionURL string `yaml:"action_url" doc:"action_card 按钮的跳转地址，format 为 action_card 时必填"`
+	Secret    string `yaml:"secret" doc:"安全设置中的加签密钥 (SEC 开头)，开启加签时必填"`
+}
+
+// DingtalkResponse 钉钉机器人响应，HTTP 状态码为 200 时 errcode 不为 0 也是失败
+type DingtalkResponse struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+// dingtalkPermanentErrors 关键词、加签、IP 白名单不匹配 (310000)，token 不存在 (300005) 等重试也无法成功的错误
+var dingtalkPermanentErrors = map[int]bool{
+	310000: true,
+	300005: true,
+}
+
+func (n *DingtalkNotifier) Validate() error {
+	if err := checkEnum("format", n.Format, "text", "markdown", "action_card"); err != nil {
+		return err
+	}
+	if _, err := url.Parse(n.URL); err != nil {
+		return fmt.Errorf("解析 webhook 地址失败: %v", err)
+	}
+	if n.Format == "action_card" {
+		if n.ActionURL == "" {
+			return fmt.Errorf("action_card 格式缺少 action_url")
+		}
+		if _, err := url.Parse(n.ActionURL); err != nil {
+			return fmt.Errorf("解析 action_url 失败: %v", err)
+		}
+	}
+	return nil
+}
+
+func (n *DingtalkNotifier) Send(ctx context.Context, msg *Message) error {
+	dingtalkMsg := DingtalkRequest{MsgType: "text"}
+	switch n.Format {
+	case "markdown":
+		dingtalkMsg.MsgType = "markdown"
+		dingtalkMsg.Markdown = &DingtalkMarkdown{Title: msg.Title, Text: dingtalkMarkdown.render(msg)}
+	case "action_card":
+		dingtalkMsg.MsgType = "actionCard"
+		dingtalkMsg.ActionCard = &DingtalkActionCard{
+			Title:       msg.Title,
+			Text:        dingtalkMarkdown.render(msg),
+			SingleTitle: "查看详情",
+			SingleURL:   n.ActionURL,
+		}
+	default:
+		dingtalkMsg.Text = &struct {
+			Content string `json:"content"`
+		}{fmt.Sprintf("%s\n%s", msg.Title, msg.Content)}
+	}
+
+	webhook, err := n.signedURL(time.Now())
+	if err != nil {
+		return &permanentError{err}
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	body, err := postJSON(ctx, client, webhook, dingtalkMsg)
+	if err != nil {
+		return err
+	}
+	var resp DingtalkResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("解析响应失败: %v, 响应: %s", err, truncate(string(body), 200))
+	}
+	if resp.ErrCode != 0 {
+		err := fmt.Errorf("钉钉返回错误 errcode=%d: %w", resp.ErrCode, &HTTPError{StatusCode: http.StatusOK, Body: string(body)})
+		if dingtalkPermanentErrors[resp.ErrCode] {
+			return &permanentError{err}
+		}
+		return err
+	}
+	return nil
+}
+
+// signedURL 开启加签时在地址上追加 timestamp 和 sign：
+// sign = Base64(HmacSHA256(secret, timestamp + "\n" + secret))，timestamp 为毫秒
+func (n *DingtalkNotifier) signedURL(now time.Time) (string, error) {
+	if n.Secret == "" {
+		return n.URL, nil
+	}
+	u, err := url.Parse(n.URL)
+	if err != nil {
+		return "", fmt.Errorf("解析 webhook 地址失败: %v", err)
+	}
+	timestamp := strconv.FormatInt(now.UnixMilli(), 10)
+	mac := hmac.New(sha256.New, []byte(n.Secret))
+	mac.Write([]byte(timestamp + "\n" + n.Secret))
+	q := u.Query()
+	q.Set("timestamp", timestamp)
+	q.Set("sign", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	RegisterNotifier("discord", func() Notifier { return &DiscordNotifier{} })
+}
+
+// discordMaxWait 被限流时在发送过程中等待的最长时间，更久的交给投递队列稍后重试
+const discordMaxWait = 10 * time.Second
+
+// DiscordNotifier Discord webhook，使用 embed 展示发送人、phone_id、时间和验证码
+type DiscordNotifier struct {
+	URL      string `yaml:"url" required:"true" doc:"Discord webhook 地址，如 https://discord.com/api/webhooks/xxx/yyy"`
+	Username string `yaml:"username" doc:"显示的机器人名称，不填使用 webhook 的默认名称"`
+	Proxy    string `yaml:"proxy" doc:"代理地址，如 http://127.0.0.1:8080 或 socks5://127.0.0.1:1080，可选"`
+}
+
+// DiscordRequest Discord webhook 请求结构
+type DiscordRequest struct {
+	Username string         `json:"username,omitempty"`
+	Content  string         `json:"content,omitempty"`
+	Embeds   []DiscordEmbed `json:"embeds"`
+}
+
+// DiscordEmbed Discord 消息 embed
+type DiscordEmbed struct {
+	Title       string              `json:"title"`
+	Description string              `json:"description,omitempty"`
+	Color       int                 `json:"color"`
+	Fields      []DiscordEmbedField `json:"fields,omitempty"`
+	Timestamp   string              `json:"timestamp,omitempty"`
+}
+
+// DiscordEmbedField embed 中的字段
+type DiscordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+func (n *DiscordNotifier) Validate() error {
+	if _, err := url.Parse(n.URL); err != nil {
+		return fmt.Errorf("解析 webhook 地址失败: %v", err)
+	}
+	return validateProxy(n.Proxy)
+}
+
+func (n *DiscordNotifier) Send(ctx context.Context, msg *Message) error {
+	payload := DiscordRequest{Username: n.Username, Embeds: []DiscordEmbed{discordEmbed(msg)}}
+	client := newHTTPClient(30*time.Second, n.Proxy)
+
+	for {
+		_, err := postJSON(ctx, client, n.URL, payload)
+		wait, limited := discordRetryAfter(err)
+		if !limited || wait > discordMaxWait {
+			return err
+		}
+		log.Warnf("Discord 限流，%s 后重试", wait)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// discordRetryAfter 从 429 响应中读取需要等待的时间
+func discordRetryAfter(err error) (time.Duration, bool) {
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	var body struct {
+		RetryAfter float64 `json:"retry_after"` // 秒，可能带小数
+	}
+	if json.Unmarshal([]byte(httpErr.Body), &body) != nil {
+		return 0, false
+	}
+	return time.Duration(body.RetryAfter * float64(time.Second)), true
+}
+
+// discordEmbed 标题为规则名称，字段为发送人、phone_id、时间和验证码，正文放在描述中
+func discordEmbed(msg *Message) DiscordEmbed {
+	embed := DiscordEmbed{Title: msg.Title, Color: 0x2ecc71}
+	d := msg.Data
+	if d == nil {
+		embed.Description = truncateRunes(4000, msg.Content)
+		return embed
+	}
+	if d.RuleName != "" {
+		embed.Title = d.RuleName
+	}
+	if d.Call {
+		embed.Color = 0xe67e22
+	}
+	embed.Description = truncateRunes(4000, msg.Body)
+	if embed.Description == "" {
+		embed.Description = msg.Title
+	}
+	add := func(name, value string) {
+		if value != "" {
+			embed.Fields = append(embed.Fields, DiscordEmbedField{Name: name, Value: truncateRunes(1000, value), Inline: true})
+		}
+	}
+	add("发送人", d.Number)
+	add("phone_id", d.PhoneID)
+	add("时间", d.Time)
+	if code := d.verificationCode(); code != "" {
+		add("验证码", "`"+code+"`")
+	}
+	if d.Call {
+		add("联系人", d.Name)
+		add("类型", d.CallType)
+	}
+	if d.Time != "" {
+		embed.Timestamp = parseEventTime(d.Time).Format(time.RFC3339)
+	}
+	return embed
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+func init() {
+	RegisterNotifier("email", func() Notifier { return &EmailNotifier{} })
+}
+
+// EmailNotifier SMTP 邮件，同时包含纯文本和 HTML 两种正文
+type EmailNotifier struct {
+	SMTPHost    string      `yaml:"smtp_host" required:"true" doc:"SMTP 服务器地址"`
+	SMTPPort    string      `yaml:"smtp_port" required:"true" types:"string,integer" doc:"SMTP 端口，如 465、587"`
+	Security    string      `yaml:"security" enum:"tls,starttls,none" doc:"加密方式: tls 直接 TLS 连接 (465), starttls 明文连接后升级 (587), none 不加密。不填时 465 端口使用 tls，其他端口在服务器支持时使用 starttls"`
+	Auth        string      `yaml:"auth" enum:"plain,login,cram-md5" default:"plain" doc:"认证方式，username 为空时不认证"`
+	Username    string      `yaml:"username" doc:"SMTP 用户名"`
+	Password    string      `yaml:"password" doc:"SMTP 密码或授权码"`
+	From        string      `yaml:"from" required:"true" doc:"发件人，可以带名称，如 短信转发 <a@example.com>"`
+	To          AddressList `yaml:"to" required:"true" doc:"收件人，多个用逗号分隔或写成列表"`
+	CC          AddressList `yaml:"cc" doc:"抄送"`
+	BCC         AddressList `yaml:"bcc" doc:"密送，不会出现在邮件头中"`
+	Timeout     int         `yaml:"timeout" default:"10" doc:"连接超时（秒）"`
+	TLSInsecure bool        `yaml:"tls_insecure" doc:"不校验服务器证书，仅用于自签名证书的内网服务器"`
+
+	from *mail.Address
+}
+
+// AddressList 邮件地址列表，配置中可以写成逗号分隔的字符串或字符串列表
+type AddressList []string
+
+// UnmarshalYAML 支持逗号（或分号）分隔的字符串和字符串列表两种写法
+func (l *AddressList) UnmarshalYAML(value *yaml.Node) error {
+	var items []string
+	if value.Kind == yaml.SequenceNode {
+		if err := value.Decode(&items); err != nil {
+			return err
+		}
+	} else {
+		items = strings.FieldsFunc(value.Value, func(r rune) bool { return r == ',' || r == ';' })
+	}
+	*l = nil
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// JSONSchema 对应 UnmarshalYAML 支持的两种写法
+func (AddressList) JSONSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"oneOf": []interface{}{
+			map[string]interface{}{"type": "string"},
+			map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		},
+	}
+}
+
+// parse 解析为地址列表，名称部分可以包含中文
+func (l AddressList) parse(name string) ([]*mail.Address, error) {
+	var list []*mail.Address
+	for _, item := range l {
+		addr, err := mail.ParseAddress(item)
+		if err != nil {
+			return nil, fmt.Errorf("%s 地址格式错误 %q: %v", name, item, err)
+		}
+		list = append(list, addr)
+	}
+	return list, nil
+}
+
+func (n *EmailNotifier) Validate() error {
+	if port, err := strconv.Atoi(n.SMTPPort); err != nil || port <= 0 || port > 65535 {
+		return fmt.Errorf("smtp_port 应为端口号: %s", n.SMTPPort)
+	}
+	if err := checkEnum("security", n.Security, "tls", "starttls", "none"); err != nil {
+		return err
+	}
+	if err := checkEnum("auth", n.Auth, "plain", "login", "cram-md5"); err != nil {
+		return err
+	}
+	if n.Timeout < 0 {
+		return fmt.Errorf("timeout 不能小于 0")
+	}
+	from, err := mail.ParseAddress(n.From)
+	if err != nil {
+		return fmt.Errorf("from 地址格式错误: %v", err)
+	}
+	n.from = from
+	if len(n.To) == 0 {
+		return fmt.Errorf("to 至少需要一个收件人")
+	}
+	for _, f := range []struct {
+		name string
+		list AddressList
+	}{{"to", n.To}, {"cc", n.CC}, {"bcc", n.BCC}} {
+		if _, err := f.list.parse(f.name); err != nil {
+			return err
+		}
+	}
+	// net/smtp 不允许在未加密的连接上以明文发送密码
+	if n.Security == "none" && n.Username != "" && n.Auth != "cram-md5" && !isLocalhost(n.SMTPHost) {
+		return fmt.Errorf("security 为 none 时只能使用 cram-md5 认证")
+	}
+	return nil
+}
+
+// security 未配置时按端口推断：465 为直接 TLS，其他端口优先 STARTTLS
+func (n *EmailNotifier) security() string {
+	if n.Security != "" {
+		return n.Security
+	}
+	if n.SMTPPort == "465" {
+		return "tls"
+	}
+	return ""
+}
+
+func (n *EmailNotifier) Send(ctx context.Context, msg *Message) error {
+	to, _ := n.To.parse("to")
+	cc, _ := n.CC.parse("cc")
+	bcc, _ := n.BCC.parse("bcc")
+	body, err := n.buildMessage(msg, to, cc)
+	if err != nil {
+		return err
+	}
+
+	client, err := n.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if n.Username != "" {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return &permanentError{fmt.Errorf("SMTP 服务器不支持认证，请检查加密方式和端口")}
+		}
+		if err := client.Auth(n.smtpAuth()); err != nil {
+			return smtpError("认证失败", err)
+		}
+	}
+	if err := client.Mail(n.from.Address); err != nil {
+		return smtpError("发件人被拒绝", err)
+	}
+	for _, list := range [][]*mail.Address{to, cc, bcc} {
+		for _, addr := range list {
+			if err := client.Rcpt(addr.Address); err != nil {
+				return smtpError("收件人被拒绝 "+addr.Address, err)
+			}
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return smtpError("发送邮件失败", err)
+	}
+	if _, err := w.Write(body); err != nil {
+		return fmt.Errorf("发送邮件失败: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return smtpError("发送邮件失败", err)
+	}
+	return client.Quit()
+}
+
+// dial 建立连接并按加密方式完成 TLS 握手，整个会话的超时为连接超时的 3 倍
+func (n *EmailNotifier) dial(ctx context.Context) (*smtp.Client, error) {
+	timeout := time.Duration(n.Timeout) * time.Second
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	addr := net.JoinHostPort(n.SMTPHost, n.SMTPPort)
+	tlsConfig := &tls.Config{ServerName: n.SMTPHost, InsecureSkipVerify: n.TLSInsecure}
+	security := n.security()
+
+	dialCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var conn net.Conn
+	var err error
+	if security == "tls" {
+		conn, err = (&tls.Dialer{Config: tlsConfig}).DialContext(dialCtx, "tcp", addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(dialCtx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("连接 SMTP 服务器失败: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(3 * timeout))
+
+	client, err := smtp.NewClient(conn, n.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("连接 SMTP 服务器失败: %v", err)
+	}
+	if security == "tls" || security == "none" {
+		return client, nil
+	}
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("STARTTLS 失败: %v", err)
+		}
+	} else if security == "starttls" {
+		client.Close()
+		return nil, &permanentError{fmt.Errorf("SMTP 服务器不支持 STARTTLS")}
+	}
+	return client, nil
+}
+
+func (n *EmailNotifier) smtpAuth() smtp.Auth {
+	switch n.Auth {
+	case "login":
+		return &loginAuth{username: n.Username, password: n.Password, host: n.SMTPHost}
+	case "cram-md5":
+		return smtp.CRAMMD5Auth(n.Username, n.Password)
+	default:
+		return smtp.PlainAuth("", n.Username, n.Password, n.SMTPHost)
+	}
+}
+
+// smtpError 5xx 为永久错误（认证失败、地址被拒绝等），重试也不会成功
+func smtpError(action string, err error) error {
+	wrapped := fmt.Errorf("%s: %w", action, err)
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) && tpErr.Code >= 500 {
+		return &permanentError{wrapped}
+	}
+	return wrapped
+}
+
+// buildMessage 生成带 From/To/Date/Message-ID 等邮件头的 multipart/alternative 邮件，密送不写入邮件头
+func (n *EmailNotifier) buildMessage(msg *Message, to, cc []*mail.Address) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	header := func(name, value string) { fmt.Fprintf(&buf, "%s: %s\r\n", name, value) }
+	header("From", n.from.String())
+	header("To", joinAddresses(to))
+	if len(cc) > 0 {
+		header("Cc", joinAddresses(cc))
+	}
+	header("Subject", mime.QEncoding.Encode("UTF-8", msg.Title))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", messageID(n.from.Address))
+	header("MIME-Version", "1.0")
+	header("Content-Type", `multipart/alternative; boundary="`+mw.Boundary()+`"`)
+	buf.WriteString("\r\n")
+
+	parts := []struct{ contentType, content string }{
+		{"text/plain", msg.Content},
+		{"text/html", "<!DOCTYPE html><html><body>" + htmlMessage.render(msg) + "</body></html>"},
+	}
+	for _, p := range parts {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType + "; charset=UTF-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(w)
+		if _, err := qw.Write([]byte(strings.ReplaceAll(p.content, "\n", "\r\n"))); err != nil {
+			return nil, err
+		}
+		qw.Close()
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func joinAddresses(list []*mail.Address) string {
+	items := make([]string, len(list))
+	for i, addr := range list {
+		items[i] = addr.String()
+	}
+	return strings.Join(items, ", ")
+}
+
+// messageID 使用发件人的域名生成唯一的 Message-ID，缺少该头的邮件容易被判为垃圾邮件
+func messageID(from string) string {
+	domain := "forwardsms.local"
+	if i := strings.LastIndex(from, "@"); i >= 0 && i < len(from)-1 {
+		domain = from[i+1:]
+	}
+	b := make([]byte, 12)
+	rand.Read(b)
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(b), domain)
+}
+
+// loginAuth AUTH LOGIN，部分国内邮箱和 Exchange 只支持这种方式。与 PlainAuth 一样只在加密连接或本机上发送密码
+type loginAuth struct {
+	username, password, host string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("连接未加密，拒绝发送密码")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("服务器地址与 smtp_host 不一致")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	}
+	return nil, fmt.Errorf("未知的 LOGIN 认证步骤: %s", fromServer)
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func init() {
+	RegisterNotifier("feishu", func() Notifier { return &FeishuNotifier{} })
+}
+
+// FeishuRequest 飞书机器人请求结构
+type FeishuRequest struct {
+	MsgType string `json:"msg_type"`
+	Content *struct {
+		Text string `json:"text"`
+	} `json:"content,omitempty"`
+	Card      map[string]interface{} `json:"card,omitempty"`
+	Timestamp string                 `json:"timestamp,omitempty"`
+	Sign      string                 `json:"sign,omitempty"`
+}
+
+// FeishuResponse 飞书机器人响应，HTTP 状态码为 200 时 code 不为 0 也是失败
+type FeishuResponse struct {
+	Code       *int   `json:"code"`
+	Msg        string `json:"msg"`
+	StatusCode *int   `json:"StatusCode"` // 旧版接口
+}
+
+// FeishuNotifier 飞书群机器人
+type FeishuNotifier struct {
+	URL    string `yaml:"url" required:"true" doc:"飞书群机器人 webhook 地址"`
+	Format string `yaml:"format" enum:"text,card" default:"text" doc:"消息格式: text 纯文本, card 消息卡片，发送人、验证码和正文分开展示"`
+	Secret string `yaml:"secret" doc:"安全设置中的签名校验密钥，开启签名校验时必填"`
+}
+
+// feishuPermanentErrors webhook 地址无效 (19001)、签名校验失败 (19021)、IP 不在白名单 (19022)、
+// 不含关键词 (19024) 等重试也无法成功的错误
+var feishuPermanentErrors = map[int]bool{
+	19001: true,
+	19021: true,
+	19022: true,
+	19024: true,
+}
+
+func (n *FeishuNotifier) Validate() error {
+	return checkEnum("format", n.Format, "text", "card")
+}
+
+func (n *FeishuNotifier) Send(ctx context.Context, msg *Message) error {
+	feishuMsg := FeishuRequest{MsgType: "text"}
+	if n.Format == "card" {
+		feishuMsg = FeishuRequest{MsgType: "interactive", Card: feishuCard(msg)}
+	} else {
+		feishuMsg.Content = &struct {
+			Text string `json:"text"`
+		}{fmt.Sprintf("%s\n%s", msg.Title, msg.Content)}
+	}
+
+	if n.Secret != "" {
+		feishuMsg.Timestamp, feishuMsg.Sign = feishuSign(n.Secret, time.Now())
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	body, err := postJSON(ctx, client, n.URL, feishuMsg)
+	if err != nil {
+		return err
+	}
+	var resp FeishuResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("解析响应失败: %v, 响应: %s", err, truncate(string(body), 200))
+	}
+	if resp.Code != nil && *resp.Code != 0 {
+		err := fmt.Errorf("飞书返回错误 code=%d: %w", *resp.Code, &HTTPError{StatusCode: http.StatusOK, Body: string(body)})
+		if feishuPermanentErrors[*resp.Code] {
+			return &permanentError{err}
+		}
+		return err
+	}
+	if resp.Code == nil && (resp.StatusCode == nil || *resp.StatusCode != 0) {
+		return fmt.Errorf("飞书响应格式错误: %s", truncate(string(body), 200))
+	}
+	return nil
+}
+
+// feishuSign 飞书签名：以 timestamp + "\n" + secret 为密钥对空内容做 HmacSHA256 后 Base64，timestamp 为秒
+func feishuSign(secret string, now time.Time) (string, string) {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(timestamp+"\n"+secret))
+	return timestamp, base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
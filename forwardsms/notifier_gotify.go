@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+func init() {
+	RegisterNotifier("gotify", func() Notifier { return &GotifyNotifier{} })
+}
+
+type GotifyRequest struct {
+	Title    string `json:"title"`
+	Message  string `json:"message"`
+	Priority int    `json:"priority,omitempty"`
+}
+
+// GotifyNotifier Gotify 推送
+type GotifyNotifier struct {
+	URL   string `yaml:"url" required:"true" doc:"Gotify 服务地址"`
+	Token string `yaml:"token" required:"true" doc:"Gotify 应用 token"`
+}
+
+func (n *GotifyNotifier) Validate() error {
+	return nil
+}
+
+func (n *GotifyNotifier) Send(ctx context.Context, msg *Message) error {
+	payload := GotifyRequest{
+		Title:    msg.MobileTitle,
+		Message:  msg.Brief,
+		Priority: 9,
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	_, err := postJSON(ctx, client, n.URL+"/message?token="+url.QueryEscape(n.Token), payload)
+	return err
+}
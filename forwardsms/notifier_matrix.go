@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	RegisterNotifier("matrix", func() Notifier { return &MatrixNotifier{} })
+}
+
+// MatrixNotifier Matrix，通过 client-server API 向房间发送 m.room.message。
+// 消息本身不做端到端加密，依赖自建 homeserver 保证传输和存储安全
+type MatrixNotifier struct {
+	Homeserver      string `yaml:"homeserver" required:"true" doc:"homeserver 地址，如 https://matrix.example.com"`
+	AccessToken     string `yaml:"access_token" required:"true" doc:"机器人账号的 access token"`
+	RoomID          string `yaml:"room_id" required:"true" doc:"房间 ID，如 !abcdef:example.com"`
+	CheckEncryption bool   `yaml:"check_encryption" doc:"首次发送时检查房间是否开启了端到端加密，未开启时在日志中警告"`
+
+	checkOnce sync.Once
+}
+
+// MatrixMessage m.room.message 事件内容，同时包含纯文本和 HTML
+type MatrixMessage struct {
+	MsgType       string `json:"msgtype"`
+	Body          string `json:"body"`
+	Format        string `json:"format,omitempty"`
+	FormattedBody string `json:"formatted_body,omitempty"`
+}
+
+// MatrixError Matrix 接口的错误响应
+type MatrixError struct {
+	ErrCode string `json:"errcode"`
+	Error   string `json:"error"`
+}
+
+// matrixPermanentErrors token 无效、没有房间权限等重试也无法成功的错误
+var matrixPermanentErrors = map[string]bool{
+	"M_UNKNOWN_TOKEN":    true,
+	"M_MISSING_TOKEN":    true,
+	"M_FORBIDDEN":        true,
+	"M_NOT_FOUND":        true,
+	"M_USER_DEACTIVATED": true,
+}
+
+func (n *MatrixNotifier) Validate() error {
+	u, err := url.Parse(n.Homeserver)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("homeserver 应为 http/https 地址: %s", n.Homeserver)
+	}
+	if !strings.HasPrefix(n.RoomID, "!") {
+		return fmt.Errorf("room_id 应为 ! 开头的房间 ID，而不是房间别名: %s", n.RoomID)
+	}
+	return nil
+}
+
+func (n *MatrixNotifier) roomURL(path string) string {
+	return fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/%s", strings.TrimSuffix(n.Homeserver, "/"), url.PathEscape(n.RoomID), path)
+}
+
+func (n *MatrixNotifier) Send(ctx context.Context, msg *Message) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	if n.CheckEncryption {
+		n.checkOnce.Do(func() { n.checkRoomEncryption(ctx, client) })
+	}
+
+	content := MatrixMessage{
+		MsgType:       "m.text",
+		Body:          fmt.Sprintf("%s\n%s", msg.Title, msg.Content),
+		Format:        "org.matrix.custom.html",
+		FormattedBody: htmlMessage.render(msg),
+	}
+	data, err := json.Marshal(content)
+	if err != nil {
+		return fmt.Errorf("序列化请求失败: %v", err)
+	}
+	// 重试时使用相同的事务 ID，homeserver 会去重，不会重复发送
+	sendURL := n.roomURL("send/m.room.message/" + url.PathEscape(matrixTxnID(ctx)))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, sendURL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+n.AccessToken)
+
+	_, err = doRequest(client, req)
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		var matrixErr MatrixError
+		if json.Unmarshal([]byte(httpErr.Body), &matrixErr) == nil && matrixPermanentErrors[matrixErr.ErrCode] {
+			return &permanentError{err}
+		}
+	}
+	return err
+}
+
+// matrixProcessID 进程启动时生成的随机标识，直接发送时用于事务 ID
+var matrixProcessID = func() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}()
+
+// matrixTxnID 事务 ID：经过投递队列时使用投递 ID，重试时不变，包含队列标识，重建队列后不会与之前的事务 ID 重复；
+// 直接发送时不会重试，使用进程标识加当前时间，避免内容相同的两条短信被 homeserver 当作重复请求
+func matrixTxnID(ctx context.Context) string {
+	if id, ok := deliveryID(ctx); ok {
+		return "forwardsms-" + id
+	}
+	return fmt.Sprintf("forwardsms-%s-t%d", matrixProcessID, time.Now().UnixNano())
+}
+
+// checkRoomEncryption 房间没有 m.room.encryption 状态时表示未开启端到端加密
+func (n *MatrixNotifier) checkRoomEncryption(ctx context.Context, client *http.Client) {
+	logger := log.WithField("room_id", n.RoomID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, n.roomURL("state/m.room.encryption/"), nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+n.AccessToken)
+	_, err = doRequest(client, req)
+	var httpErr *HTTPError
+	switch {
+	case err == nil:
+		logger.Info("Matrix 房间已开启端到端加密")
+	case errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound:
+		logger.Warn("Matrix 房间未开启端到端加密，包含验证码的消息将以明文保存在房间中")
+	default:
+		logger.Warnf("检查 Matrix 房间加密状态失败: %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+func init() {
+	RegisterNotifier("mqtt", func() Notifier { return &MQTTNotifier{} })
+}
+
+// MQTTNotifier 将短信和来电以 JSON 发布到 MQTT broker，供 Home Assistant、Node-RED 等订阅。
+// 每次发送单独建立连接，发布完成后断开，热加载时不需要管理长连接
+type MQTTNotifier struct {
+	Broker      string `yaml:"broker" required:"true" doc:"broker 地址，如 tcp://127.0.0.1:1883、ssl://example.com:8883、ws://example.com:8083/mqtt"`
+	Topic       string `yaml:"topic" default:"forwardsms/{type}/{phone_id}/{number}" doc:"主题模板，可用 {type} (sms/call)、{phone_id}、{number}、{rule}、{source}、{sms_id}、{call_type}"`
+	QoS         int    `yaml:"qos" doc:"QoS 等级 0、1、2"`
+	Retain      bool   `yaml:"retain" doc:"保留消息，新订阅者会立即收到每个主题的最后一条消息"`
+	Username    string `yaml:"username" doc:"用户名"`
+	Password    string `yaml:"password" doc:"密码"`
+	ClientID    string `yaml:"client_id" default:"forwardsms" doc:"客户端 ID 前缀，每次连接追加随机后缀，避免并发发送时互相踢下线"`
+	CAFile      string `yaml:"ca_file" doc:"自签名证书的 CA 文件路径，ssl/wss 连接使用"`
+	TLSInsecure bool   `yaml:"tls_insecure" doc:"不校验 broker 证书，仅用于测试"`
+
+	tlsConfig *tls.Config
+}
+
+// MQTTSMSPayload 短信消息，为原始请求加上触发的规则名称和识别到的验证码，不包含 secret。
+// 短信不含验证码关键字时没有 code 字段，自动化可以直接以 code 是否存在作为触发条件
+type MQTTSMSPayload struct {
+	SMSRequest
+	Rule string `json:"rule"`
+	Code string `json:"code,omitempty"`
+}
+
+// MQTTCallPayload 来电消息
+type MQTTCallPayload struct {
+	CallRequest
+	Rule string `json:"rule"`
+}
+
+var mqttPlaceholder = regexp.MustCompile(`\{(\w+)\}`)
+
+var mqttTopicFields = map[string]func(d *MessageData) string{
+	"type": func(d *MessageData) string {
+		if d.Call {
+			return "call"
+		}
+		return "sms"
+	},
+	"phone_id":  func(d *MessageData) string { return d.PhoneID },
+	"number":    func(d *MessageData) string { return d.Number },
+	"rule":      func(d *MessageData) string { return d.RuleName },
+	"source":    func(d *MessageData) string { return d.Source },
+	"sms_id":    func(d *MessageData) string { return d.SMSID },
+	"call_type": func(d *MessageData) string { return d.CallType },
+}
+
+// mqttTopicEscaper 号码中的 + 等字符在发布主题中不允许出现，替换为 _
+var mqttTopicEscaper = strings.NewReplacer("/", "_", "+", "_", "#", "_", "\x00", "")
+
+func (n *MQTTNotifier) Validate() error {
+	u, err := url.Parse(n.Broker)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("broker 地址格式错误，应为 tcp://host:1883 等形式: %s", n.Broker)
+	}
+	if err := checkEnum("broker 协议", u.Scheme, "tcp", "mqtt", "ssl", "tls", "mqtts", "ws", "wss"); err != nil {
+		return err
+	}
+	if n.QoS < 0 || n.QoS > 2 {
+		return fmt.Errorf("qos 应为 0、1、2，实际为 %d", n.QoS)
+	}
+	if strings.ContainsAny(n.Topic, "+#") {
+		return fmt.Errorf("topic 不能包含通配符 + 或 #")
+	}
+	for _, m := range mqttPlaceholder.FindAllStringSubmatch(n.Topic, -1) {
+		if _, ok := mqttTopicFields[m[1]]; !ok {
+			return fmt.Errorf("topic 中的 {%s} 不支持", m[1])
+		}
+	}
+	if n.CAFile != "" || n.TLSInsecure {
+		n.tlsConfig = &tls.Config{InsecureSkipVerify: n.TLSInsecure}
+		if n.CAFile != "" {
+			pem, err := os.ReadFile(n.CAFile)
+			if err != nil {
+				return fmt.Errorf("读取 ca_file 失败: %v", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return fmt.Errorf("ca_file 中没有有效的证书: %s", n.CAFile)
+			}
+			n.tlsConfig.RootCAs = pool
+		}
+	}
+	return nil
+}
+
+// topic 渲染主题模板，旧消息没有原始字段时占位符为 unknown
+func (n *MQTTNotifier) topic(d *MessageData) string {
+	topic := n.Topic
+	if topic == "" {
+		topic = "forwardsms/{type}/{phone_id}/{number}"
+	}
+	return mqttPlaceholder.ReplaceAllStringFunc(topic, func(s string) string {
+		value := ""
+		if d != nil {
+			value = mqttTopicEscaper.Replace(mqttTopicFields[s[1:len(s)-1]](d))
+		}
+		if value == "" {
+			return "unknown"
+		}
+		return value
+	})
+}
+
+// mqttPayload 按原始请求的格式还原短信或来电，队列中没有原始字段的旧消息发送消息本身
+func mqttPayload(msg *Message) ([]byte, error) {
+	d := msg.Data
+	if d == nil {
+		return json.Marshal(msg)
+	}
+	if d.Call {
+		return json.Marshal(MQTTCallPayload{
+			CallRequest: CallRequest{
+				Number:    d.Number,
+				Name:      d.Name,
+				Time:      d.Time,
+				Type:      d.CallType,
+				Duration:  d.Duration,
+				Source:    d.Source,
+				PhoneID:   d.PhoneID,
+				Timestamp: d.Timestamp,
+			},
+			Rule: d.RuleName,
+		})
+	}
+	return json.Marshal(MQTTSMSPayload{
+		SMSRequest: SMSRequest{
+			Number:    d.Number,
+			Time:      d.Time,
+			Text:      d.Text,
+			Source:    d.Source,
+			PhoneID:   d.PhoneID,
+			SMSID:     d.SMSID,
+			Timestamp: d.Timestamp,
+		},
+		Rule: d.RuleName,
+		Code: d.verificationCode(),
+	})
+}
+
+func (n *MQTTNotifier) Send(ctx context.Context, msg *Message) error {
+	payload, err := mqttPayload(msg)
+	if err != nil {
+		return fmt.Errorf("序列化消息失败: %v", err)
+	}
+
+	prefix := n.ClientID
+	if prefix == "" {
+		prefix = "forwardsms"
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	opts := mqtt.NewClientOptions().
+		AddBroker(n.Broker).
+		SetClientID(prefix + "-" + hex.EncodeToString(suffix)).
+		SetUsername(n.Username).
+		SetPassword(n.Password).
+		SetCleanSession(true).
+		SetAutoReconnect(false).
+		SetConnectTimeout(10 * time.Second)
+	if n.tlsConfig != nil {
+		opts.SetTLSConfig(n.tlsConfig)
+	}
+	client := mqtt.NewClient(opts)
+
+	if err := waitToken(ctx, client.Connect()); err != nil {
+		// 用户名密码错误、没有权限时重试也不会成功
+		if errors.Is(err, packets.ErrorRefusedBadUsernameOrPassword) || errors.Is(err, packets.ErrorRefusedNotAuthorised) {
+			return &permanentError{fmt.Errorf("连接 MQTT broker 失败: %w", err)}
+		}
+		return fmt.Errorf("连接 MQTT broker 失败: %w", err)
+	}
+	defer client.Disconnect(250)
+
+	topic := n.topic(msg.Data)
+	if err := waitToken(ctx, client.Publish(topic, byte(n.QoS), n.Retain, payload)); err != nil {
+		return fmt.Errorf("发布到 %s 失败: %w", topic, err)
+	}
+	return nil
+}
+
+// waitToken 等待 MQTT 操作完成，QoS 1/2 时等到 broker 确认
+func waitToken(ctx context.Context, token mqtt.Token) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return fmt.Errorf("等待 MQTT 响应超时: %w", ctx.Err())
+	}
+}
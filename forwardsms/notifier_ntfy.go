@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+func init() {
+	RegisterNotifier("ntfy", func() Notifier { return &NtfyNotifier{} })
+}
+
+// NtfyNotifier ntfy.sh 或自建 ntfy 推送
+type NtfyNotifier struct {
+	Server   string       `yaml:"server" default:"https://ntfy.sh" doc:"ntfy 服务地址"`
+	Topic    string       `yaml:"topic" required:"true" doc:"主题"`
+	Priority int          `yaml:"priority" doc:"优先级 1-5，默认 3，验证码建议 4 或 5"`
+	Tags     []string     `yaml:"tags" doc:"标签，可以使用 emoji 短代码，如 [speech_balloon]"`
+	Token    string       `yaml:"token" doc:"访问令牌 (tk_...)，与 username/password 二选一"`
+	Username string       `yaml:"username" doc:"用户名"`
+	Password string       `yaml:"password" doc:"密码"`
+	Click    string       `yaml:"click" doc:"点击通知打开的地址，可以使用模板，如 sms:{{.Number}}"`
+	Actions  []NtfyAction `yaml:"actions" doc:"操作按钮，最多 3 个"`
+	CopyCode bool         `yaml:"copy_code" doc:"识别到验证码时添加 复制验证码 按钮，需要 ntfy 服务和客户端支持 copy 操作"`
+
+	click *template.Template
+}
+
+// NtfyAction ntfy 操作按钮
+type NtfyAction struct {
+	Action  string            `yaml:"action" json:"action" required:"true" enum:"view,http,broadcast,copy" doc:"按钮类型"`
+	Label   string            `yaml:"label" json:"label" required:"true" doc:"按钮文字"`
+	URL     string            `yaml:"url" json:"url,omitempty" doc:"view/http 的地址"`
+	Method  string            `yaml:"method" json:"method,omitempty" doc:"http 的请求方式，默认 POST"`
+	Headers map[string]string `yaml:"headers" json:"headers,omitempty" doc:"http 的请求头"`
+	Body    string            `yaml:"body" json:"body,omitempty" doc:"http 的请求体"`
+	Value   string            `yaml:"value" json:"value,omitempty" doc:"copy 复制的内容"`
+	Clear   bool              `yaml:"clear" json:"clear,omitempty" doc:"点击后清除通知"`
+}
+
+// NtfyRequest ntfy JSON 发布请求
+type NtfyRequest struct {
+	Topic    string       `json:"topic"`
+	Title    string       `json:"title,omitempty"`
+	Message  string       `json:"message"`
+	Priority int          `json:"priority,omitempty"`
+	Tags     []string     `json:"tags,omitempty"`
+	Click    string       `json:"click,omitempty"`
+	Actions  []NtfyAction `json:"actions,omitempty"`
+}
+
+func (n *NtfyNotifier) Validate() error {
+	if n.Server != "" {
+		if u, err := url.Parse(n.Server); err != nil || u.Host == "" {
+			return fmt.Errorf("server 应为 http/https 地址: %s", n.Server)
+		}
+	}
+	if n.Priority < 0 || n.Priority > 5 {
+		return fmt.Errorf("priority 应为 1-5，实际为 %d", n.Priority)
+	}
+	if n.Token != "" && (n.Username != "" || n.Password != "") {
+		return fmt.Errorf("token 和 username/password 只能配置一种")
+	}
+	if len(n.Actions) > 3 {
+		return fmt.Errorf("actions 最多 3 个")
+	}
+	for i, a := range n.Actions {
+		if err := checkEnum("action", a.Action, "view", "http", "broadcast", "copy"); err != nil {
+			return fmt.Errorf("actions[%d]: %v", i, err)
+		}
+		if a.Label == "" {
+			return fmt.Errorf("actions[%d]: 缺少 label", i)
+		}
+		if (a.Action == "view" || a.Action == "http") && a.URL == "" {
+			return fmt.Errorf("actions[%d]: %s 缺少 url", i, a.Action)
+		}
+	}
+	if n.Click != "" {
+		tmpl, err := parseMessageTemplate("click", n.Click)
+		if err != nil {
+			return fmt.Errorf("click 模板错误: %v", err)
+		}
+		n.click = tmpl
+	}
+	return nil
+}
+
+func (n *NtfyNotifier) Send(ctx context.Context, msg *Message) error {
+	server := n.Server
+	if server == "" {
+		server = "https://ntfy.sh"
+	}
+	payload := NtfyRequest{
+		Topic:    n.Topic,
+		Title:    msg.MobileTitle,
+		Message:  msg.Brief,
+		Priority: n.Priority,
+		Tags:     n.Tags,
+		Actions:  append([]NtfyAction(nil), n.Actions...),
+	}
+	if n.click != nil && msg.Data != nil {
+		payload.Click = executeTemplate(n.click, msg.Data)
+	}
+	if n.CopyCode && len(payload.Actions) < 3 {
+		if code := detectVerificationCode(msg.Brief); code != "" {
+			payload.Actions = append(payload.Actions, NtfyAction{Action: "copy", Label: "复制验证码 " + code, Value: code})
+		}
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("序列化请求失败: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(server, "/"), bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	switch {
+	case n.Token != "":
+		req.Header.Set("Authorization", "Bearer "+n.Token)
+	case n.Username != "":
+		req.SetBasicAuth(n.Username, n.Password)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	_, err = doRequest(client, req)
+	return err
+}
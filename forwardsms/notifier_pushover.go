@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	RegisterNotifier("pushover", func() Notifier { return &PushoverNotifier{} })
+}
+
+// PushoverNotifier Pushover 推送，priority 为 2 时为紧急通知，会重复提醒直到确认或过期
+type PushoverNotifier struct {
+	Token    string `yaml:"token" required:"true" doc:"应用 API token"`
+	User     string `yaml:"user" required:"true" doc:"用户或群组 key"`
+	Device   string `yaml:"device" doc:"只发送到指定设备，多个用逗号分隔"`
+	Priority int    `yaml:"priority" doc:"优先级 -2 到 2，2 为紧急通知"`
+	Retry    int    `yaml:"retry" default:"60" doc:"紧急通知的重复提醒间隔（秒），不小于 30"`
+	Expire   int    `yaml:"expire" default:"3600" doc:"紧急通知的提醒持续时间（秒），不超过 10800"`
+	Sound    string `yaml:"sound" doc:"提示音，如 pushover、siren、none"`
+	APIURL   string `yaml:"api_url" default:"https://api.pushover.net/1" doc:"Pushover API 地址，一般不需要修改"`
+}
+
+// PushoverResponse Pushover 接口响应，status 为 1 表示成功
+type PushoverResponse struct {
+	Status  int      `json:"status"`
+	Request string   `json:"request"`
+	Receipt string   `json:"receipt"`
+	Errors  []string `json:"errors"`
+}
+
+func (n *PushoverNotifier) Validate() error {
+	if n.Priority < -2 || n.Priority > 2 {
+		return fmt.Errorf("priority 应为 -2 到 2，实际为 %d", n.Priority)
+	}
+	if n.Priority == 2 {
+		if n.Retry != 0 && n.Retry < 30 {
+			return fmt.Errorf("retry 不能小于 30 秒")
+		}
+		if n.Expire < 0 || n.Expire > 10800 {
+			return fmt.Errorf("expire 应为 1 到 10800 秒")
+		}
+	}
+	if n.APIURL != "" {
+		if _, err := url.Parse(n.APIURL); err != nil {
+			return fmt.Errorf("解析 api_url 失败: %v", err)
+		}
+	}
+	return nil
+}
+
+func (n *PushoverNotifier) apiURL() string {
+	if n.APIURL == "" {
+		return "https://api.pushover.net/1"
+	}
+	return strings.TrimSuffix(n.APIURL, "/")
+}
+
+func (n *PushoverNotifier) Send(ctx context.Context, msg *Message) error {
+	form := url.Values{}
+	form.Set("token", n.Token)
+	form.Set("user", n.User)
+	form.Set("title", truncateRunes(250, msg.MobileTitle))
+	form.Set("message", truncateRunes(1024, msg.Brief))
+	if n.Device != "" {
+		form.Set("device", n.Device)
+	}
+	if n.Sound != "" {
+		form.Set("sound", n.Sound)
+	}
+	if n.Priority != 0 {
+		form.Set("priority", strconv.Itoa(n.Priority))
+	}
+	retry, expire := n.Retry, n.Expire
+	if retry == 0 {
+		retry = 60
+	}
+	if expire == 0 {
+		expire = 3600
+	}
+	if n.Priority == 2 {
+		form.Set("retry", strconv.Itoa(retry))
+		form.Set("expire", strconv.Itoa(expire))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.apiURL()+"/messages.json", strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client := &http.Client{Timeout: 10 * time.Second}
+	body, err := doRequest(client, req)
+
+	// 4xx 为 token、user 等参数错误，重试也不会成功
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode >= 400 && httpErr.StatusCode < 500 && httpErr.StatusCode != http.StatusTooManyRequests {
+		return &permanentError{err}
+	}
+	if err != nil {
+		return err
+	}
+	var resp PushoverResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("解析响应失败: %v", err)
+	}
+	if resp.Status != 1 {
+		return fmt.Errorf("Pushover 返回错误: %s", strings.Join(resp.Errors, "; "))
+	}
+	if resp.Receipt != "" {
+		rule := ""
+		if msg.Data != nil {
+			rule = msg.Data.RuleName
+		}
+		now := time.Now()
+		pushoverReceipts.Track(&PushoverReceipt{
+			Receipt:   resp.Receipt,
+			Rule:      rule,
+			Title:     msg.MobileTitle,
+			CreatedAt: now,
+			ExpiresAt: now.Add(time.Duration(expire) * time.Second),
+			token:     n.Token,
+			apiURL:    n.apiURL(),
+		})
+	}
+	return nil
+}
+
+// PushoverReceipt 紧急通知的回执，记录是否已被确认
+type PushoverReceipt struct {
+	Receipt        string    `json:"receipt"`
+	Rule           string    `json:"rule"`
+	Title          string    `json:"title"`
+	CreatedAt      time.Time `json:"created_at"`
+	Acknowledged   bool      `json:"acknowledged"`
+	AcknowledgedAt time.Time `json:"acknowledged_at,omitzero"`
+	AcknowledgedBy string    `json:"acknowledged_by,omitempty"`
+	Expired        bool      `json:"expired"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	CheckedAt      time.Time `json:"checked_at,omitzero"`
+	Abandoned      bool      `json:"abandoned"` // 查询连续失败或已过提醒时间仍查询失败，不再查询
+	LastError      string    `json:"last_error,omitempty"`
+
+	token    string
+	apiURL   string
+	failures int // 连续查询失败次数
+}
+
+// done 已确认、已过期或已放弃，不需要再查询
+func (r *PushoverReceipt) done() bool {
+	return r.Acknowledged || r.Expired || r.Abandoned
+}
+
+// receiptTracker 在内存中保存最近的紧急通知回执，后台定时查询确认状态，重启后不保留。
+// 回执保存在实例外，配置热加载后仍会继续查询
+type receiptTracker struct {
+	mu          sync.Mutex
+	receipts    []*PushoverReceipt
+	limit       int
+	interval    time.Duration
+	maxFailures int // 连续查询失败达到此次数后放弃
+	once        sync.Once
+}
+
+var pushoverReceipts = &receiptTracker{limit: 100, interval: time.Minute, maxFailures: 10}
+
+// Track 记录回执并在第一次调用时启动后台查询
+func (t *receiptTracker) Track(r *PushoverReceipt) {
+	t.mu.Lock()
+	t.receipts = append(t.receipts, r)
+	if len(t.receipts) > t.limit {
+		t.receipts = t.receipts[len(t.receipts)-t.limit:]
+	}
+	t.mu.Unlock()
+	log.WithFields(log.Fields{"rule": r.Rule, "receipt": r.Receipt}).Info("Pushover 紧急通知已发送，等待确认")
+
+	t.once.Do(func() {
+		go func() {
+			ticker := time.NewTicker(t.interval)
+			defer ticker.Stop()
+			for range ticker.C {
+				t.refresh(context.Background())
+			}
+		}()
+	})
+}
+
+// List 返回全部回执，最新的在前
+func (t *receiptTracker) List() []PushoverReceipt {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	list := make([]PushoverReceipt, 0, len(t.receipts))
+	for _, r := range t.receipts {
+		list = append(list, *r)
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+// refresh 查询所有未完成回执的状态
+func (t *receiptTracker) refresh(ctx context.Context) {
+	t.mu.Lock()
+	var pending []PushoverReceipt
+	for _, r := range t.receipts {
+		if !r.done() {
+			pending = append(pending, *r)
+		}
+	}
+	t.mu.Unlock()
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	for _, r := range pending {
+		status, err := queryReceipt(ctx, client, &r)
+		t.mu.Lock()
+		for _, tracked := range t.receipts {
+			if tracked.Receipt != r.Receipt {
+				continue
+			}
+			tracked.CheckedAt = time.Now()
+			if err != nil {
+				t.failed(tracked, err)
+				continue
+			}
+			tracked.failures, tracked.LastError = 0, ""
+			tracked.Expired = status.Expired == 1
+			if status.Acknowledged == 1 {
+				tracked.Acknowledged = true
+				tracked.AcknowledgedAt = time.Unix(status.AcknowledgedAt, 0)
+				tracked.AcknowledgedBy = status.AcknowledgedByDevice
+				log.WithFields(log.Fields{"rule": tracked.Rule, "receipt": tracked.Receipt, "device": tracked.AcknowledgedBy}).Info("Pushover 紧急通知已确认")
+			} else if tracked.Expired {
+				log.WithFields(log.Fields{"rule": tracked.Rule, "receipt": tracked.Receipt}).Warn("Pushover 紧急通知过期仍未确认")
+			}
+		}
+		t.mu.Unlock()
+	}
+}
+
+// failed 记录一次查询失败。token 被撤销、回执已被清理等情况下会一直失败，
+// 连续失败 maxFailures 次或已过提醒时间后放弃，只记录一次日志
+func (t *receiptTracker) failed(r *PushoverReceipt, err error) {
+	r.failures++
+	r.LastError = err.Error()
+	logger := log.WithFields(log.Fields{"rule": r.Rule, "receipt": r.Receipt})
+	if r.failures < t.maxFailures && r.CheckedAt.Before(r.ExpiresAt) {
+		logger.Debugf("查询 Pushover 回执失败: %v", err)
+		return
+	}
+	r.Abandoned = true
+	logger.Warnf("查询 Pushover 回执连续失败 %d 次，不再查询: %v", r.failures, err)
+}
+
+// pushoverReceiptStatus 回执查询接口的响应
+type pushoverReceiptStatus struct {
+	Status               int    `json:"status"`
+	Acknowledged         int    `json:"acknowledged"`
+	AcknowledgedAt       int64  `json:"acknowledged_at"`
+	AcknowledgedByDevice string `json:"acknowledged_by_device"`
+	Expired              int    `json:"expired"`
+}
+
+func queryReceipt(ctx context.Context, client *http.Client, r *PushoverReceipt) (*pushoverReceiptStatus, error) {
+	u := fmt.Sprintf("%s/receipts/%s.json?token=%s", r.apiURL, url.PathEscape(r.Receipt), url.QueryEscape(r.token))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %v", err)
+	}
+	body, err := doRequest(client, req)
+	if err != nil {
+		return nil, err
+	}
+	var status pushoverReceiptStatus
+	if err := json.Unmarshal(body, &status); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %v", err)
+	}
+	if status.Status != 1 {
+		return nil, fmt.Errorf("回执不存在或已失效")
+	}
+	return &status, nil
+}
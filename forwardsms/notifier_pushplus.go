@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+func init() {
+	RegisterNotifier("pushplus", func() Notifier { return &PushPlusNotifier{} })
+}
+
+// PushPlusNotifier PushPlus 推送加
+type PushPlusNotifier struct {
+	Token    string `yaml:"token" required:"true" doc:"用户 token"`
+	Topic    string `yaml:"topic" doc:"群组编码，填写后发送给群组内所有人"`
+	Template string `yaml:"template" enum:"html,markdown,txt" default:"html" doc:"消息模板: html, markdown, txt"`
+	Channel  string `yaml:"channel" doc:"发送渠道，如 wechat、webhook、mail，默认 wechat"`
+	APIURL   string `yaml:"api_url" default:"https://www.pushplus.plus/send" doc:"接口地址，一般不需要修改"`
+}
+
+// PushPlusRequest PushPlus 发送请求
+type PushPlusRequest struct {
+	Token    string `json:"token"`
+	Title    string `json:"title"`
+	Content  string `json:"content"`
+	Template string `json:"template"`
+	Topic    string `json:"topic,omitempty"`
+	Channel  string `json:"channel,omitempty"`
+}
+
+// PushPlusResponse PushPlus 响应，HTTP 状态码为 200 时 code 不为 200 也是失败
+type PushPlusResponse struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+func (n *PushPlusNotifier) Validate() error {
+	return checkEnum("template", n.Template, "html", "markdown", "txt")
+}
+
+func (n *PushPlusNotifier) Send(ctx context.Context, msg *Message) error {
+	payload := PushPlusRequest{
+		Token:    n.Token,
+		Title:    msg.MobileTitle,
+		Template: n.Template,
+		Topic:    n.Topic,
+		Channel:  n.Channel,
+	}
+	switch n.Template {
+	case "markdown":
+		payload.Content = standardMarkdown.render(msg)
+	case "txt":
+		payload.Content = fmt.Sprintf("%s\n%s", msg.Title, msg.Content)
+	default:
+		payload.Template = "html"
+		payload.Content = htmlMessage.render(msg)
+	}
+	apiURL := n.APIURL
+	if apiURL == "" {
+		apiURL = "https://www.pushplus.plus/send"
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	body, err := postJSON(ctx, client, apiURL, payload)
+	if err != nil {
+		return err
+	}
+	var resp PushPlusResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("解析响应失败: %v, 响应: %s", err, truncate(string(body), 200))
+	}
+	if resp.Code != 200 {
+		return fmt.Errorf("PushPlus 返回错误: code=%d, %s", resp.Code, resp.Msg)
+	}
+	return nil
+}
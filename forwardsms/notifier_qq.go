@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	RegisterNotifier("qq", func() Notifier { return &QQNotifier{} })
+}
+
+type PostData map[string]interface{}
+
+// QQNotifier QQPush 推送
+type QQNotifier struct {
+	QQ    string `yaml:"qq" required:"true" doc:"接收消息的 QQ 号"`
+	Token string `yaml:"token" required:"true" doc:"QQPush token"`
+}
+
+func (n *QQNotifier) Validate() error {
+	return nil
+}
+
+func (n *QQNotifier) Send(ctx context.Context, msg *Message) error {
+	posturl := fmt.Sprintf("https://wx.scjtqs.com/qq/push/pushMsg?token=%s", url.QueryEscape(n.Token))
+	payload := PostData{
+		"qq": n.QQ,
+		"content": []PostData{
+			{
+				"msgtype": "text",
+				"text":    fmt.Sprintf("%s\n%s", msg.Title, msg.Content),
+			},
+		},
+		"token": n.Token,
+	}
+
+	client := &http.Client{Timeout: time.Second * 30}
+	body, err := postJSON(ctx, client, posturl, payload)
+	if err != nil {
+		return err
+	}
+	log.Infof("QQPush响应: %s", string(body))
+	return nil
+}
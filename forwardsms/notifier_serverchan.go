@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterNotifier("serverchan", func() Notifier { return &ServerChanNotifier{} })
+}
+
+// serverChan3Key Server酱³ 的 SendKey 格式为 sctp{uid}t...，接口地址中需要 uid
+var serverChan3Key = regexp.MustCompile(`^sctp(\d+)t`)
+
+// ServerChanNotifier Server酱，根据 SendKey 自动选择 Turbo 版、Server酱³ 或旧版接口
+type ServerChanNotifier struct {
+	SendKey string `yaml:"sendkey" required:"true" doc:"SendKey，sctp 开头为 Server酱³，SCT 开头为 Turbo 版，SCU 开头为旧版"`
+	Channel string `yaml:"channel" doc:"Turbo 版的消息通道，如 9|66，不填使用网页上的设置"`
+	Tags    string `yaml:"tags" doc:"Server酱³ 的标签，多个用 | 分隔"`
+	APIURL  string `yaml:"api_url" doc:"自定义接口地址，填写后不再根据 SendKey 判断"`
+}
+
+// ServerChanResponse Server酱响应，HTTP 状态码为 200 时也可能失败
+type ServerChanResponse struct {
+	Code    *int   `json:"code"`    // Turbo 版、Server酱³，0 为成功
+	Message string `json:"message"` // Turbo 版、Server酱³ 的错误信息
+	Errno   *int   `json:"errno"`   // 旧版，0 为成功
+	Errmsg  string `json:"errmsg"`  // 旧版的错误信息
+}
+
+func (n *ServerChanNotifier) Validate() error {
+	if n.APIURL != "" {
+		if _, err := url.Parse(n.APIURL); err != nil {
+			return fmt.Errorf("解析 api_url 失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// endpoint 根据 SendKey 返回接口地址
+func (n *ServerChanNotifier) endpoint() string {
+	switch {
+	case n.APIURL != "":
+		return n.APIURL
+	case serverChan3Key.MatchString(n.SendKey):
+		uid := serverChan3Key.FindStringSubmatch(n.SendKey)[1]
+		return fmt.Sprintf("https://%s.push.ft07.com/send/%s.send", uid, n.SendKey)
+	case strings.HasPrefix(n.SendKey, "SCU"):
+		return fmt.Sprintf("https://sc.ftqq.com/%s.send", n.SendKey)
+	}
+	return fmt.Sprintf("https://sctapi.ftqq.com/%s.send", n.SendKey)
+}
+
+func (n *ServerChanNotifier) Send(ctx context.Context, msg *Message) error {
+	form := url.Values{}
+	form.Set("title", truncateRunes(32, msg.MobileTitle))
+	form.Set("desp", standardMarkdown.render(msg))
+	form.Set("short", truncateRunes(64, msg.Brief))
+	if n.Channel != "" {
+		form.Set("channel", n.Channel)
+	}
+	if n.Tags != "" {
+		form.Set("tags", n.Tags)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.endpoint(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client := &http.Client{Timeout: 10 * time.Second}
+	body, err := doRequest(client, req)
+	if err != nil {
+		return err
+	}
+
+	var resp ServerChanResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("解析响应失败: %v, 响应: %s", err, truncate(string(body), 200))
+	}
+	switch {
+	case resp.Code != nil && *resp.Code != 0:
+		return fmt.Errorf("Server酱返回错误: code=%d, %s", *resp.Code, resp.Message)
+	case resp.Errno != nil && *resp.Errno != 0:
+		return fmt.Errorf("Server酱返回错误: errno=%d, %s", *resp.Errno, resp.Errmsg)
+	case resp.Code == nil && resp.Errno == nil:
+		return fmt.Errorf("Server酱响应格式错误: %s", truncate(string(body), 200))
+	}
+	return nil
+}
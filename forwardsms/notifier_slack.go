@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	RegisterNotifier("slack", func() Notifier { return &SlackNotifier{} })
+}
+
+// SlackNotifier Slack，支持 incoming webhook 和机器人 chat.postMessage 两种方式。
+// 使用机器人时，同一发送人的连续消息会回复在第一条消息的话题 (thread) 中
+type SlackNotifier struct {
+	WebhookURL   string `yaml:"webhook_url" doc:"incoming webhook 地址，与 token 二选一"`
+	Token        string `yaml:"token" doc:"机器人 token (xoxb-)，需要 chat:write 权限"`
+	Channel      string `yaml:"channel" doc:"使用 token 时发送到的频道 ID 或名称"`
+	ThreadWindow string `yaml:"thread_window" default:"10m" doc:"同一发送人的连续消息在这段时间内回复到同一话题，设为 0 关闭"`
+	APIURL       string `yaml:"api_url" default:"https://slack.com/api" doc:"Slack API 地址，一般不需要修改"`
+
+	window time.Duration
+}
+
+// slackThread 频道中最近一条消息所在的话题
+type slackThread struct {
+	mu     sync.Mutex // 发送期间持有，保证同一频道的消息按顺序判断是否回复到话题
+	sender string
+	ts     string // 话题第一条消息的 ts
+	last   time.Time
+}
+
+// slackThreadStore 按机器人和频道保存最近的话题。热加载会创建新的 SlackNotifier，
+// 话题保存在实例外，配置重新加载后仍能回复到原来的话题
+type slackThreadStore struct {
+	mu      sync.Mutex
+	threads map[string]*slackThread
+}
+
+var slackThreads = &slackThreadStore{threads: map[string]*slackThread{}}
+
+// get 返回 token 对应机器人在 channel 中的话题状态，不存在时创建
+func (s *slackThreadStore) get(token, channel string) *slackThread {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := token + "/" + channel
+	t, ok := s.threads[key]
+	if !ok {
+		t = &slackThread{}
+		s.threads[key] = t
+	}
+	return t
+}
+
+// SlackRequest chat.postMessage 和 incoming webhook 共用的请求结构
+type SlackRequest struct {
+	Channel  string        `json:"channel,omitempty"`
+	Text     string        `json:"text"`
+	Blocks   []interface{} `json:"blocks,omitempty"`
+	ThreadTS string        `json:"thread_ts,omitempty"`
+}
+
+// SlackResponse chat.postMessage 的响应，失败时 HTTP 状态码仍为 200
+type SlackResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+	TS    string `json:"ts"`
+}
+
+// slackPermanentErrors 重试也无法成功的错误
+var slackPermanentErrors = map[string]bool{
+	"invalid_auth":      true,
+	"not_authed":        true,
+	"account_inactive":  true,
+	"token_revoked":     true,
+	"channel_not_found": true,
+	"not_in_channel":    true,
+	"is_archived":       true,
+	"missing_scope":     true,
+}
+
+func (n *SlackNotifier) Validate() error {
+	switch {
+	case n.WebhookURL == "" && n.Token == "":
+		return fmt.Errorf("需要配置 webhook_url 或 token")
+	case n.WebhookURL != "" && n.Token != "":
+		return fmt.Errorf("webhook_url 和 token 只能配置一个")
+	case n.Token != "" && n.Channel == "":
+		return fmt.Errorf("使用 token 时需要配置 channel")
+	}
+	n.window = 10 * time.Minute
+	if n.ThreadWindow != "" {
+		d, err := time.ParseDuration(n.ThreadWindow)
+		if err != nil {
+			return fmt.Errorf("thread_window 格式错误，应为 10m、1h 等: %v", err)
+		}
+		n.window = d
+	}
+	if n.APIURL != "" {
+		if _, err := url.Parse(n.APIURL); err != nil {
+			return fmt.Errorf("解析 api_url 失败: %v", err)
+		}
+	}
+	return nil
+}
+
+func (n *SlackNotifier) Send(ctx context.Context, msg *Message) error {
+	payload := SlackRequest{Text: fmt.Sprintf("%s\n%s", msg.Title, msg.Content), Blocks: slackBlocks(msg)}
+	client := &http.Client{Timeout: 10 * time.Second}
+	if n.WebhookURL != "" {
+		_, err := postJSON(ctx, client, n.WebhookURL, payload)
+		return err
+	}
+
+	// 同一发送人的连续消息回复到同一话题
+	sender := msg.MobileTitle
+	if msg.Data != nil {
+		sender = msg.Data.Number
+	}
+	thread := slackThreads.get(n.Token, n.Channel)
+	thread.mu.Lock()
+	defer thread.mu.Unlock()
+	now := time.Now()
+	if n.window > 0 && thread.sender == sender && now.Sub(thread.last) < n.window {
+		payload.ThreadTS = thread.ts
+	}
+	payload.Channel = n.Channel
+
+	ts, err := n.postMessage(ctx, client, payload)
+	if err != nil {
+		return err
+	}
+	if payload.ThreadTS == "" {
+		thread.sender, thread.ts = sender, ts
+	}
+	thread.last = now
+	return nil
+}
+
+// postMessage 调用 chat.postMessage，返回消息的 ts
+func (n *SlackNotifier) postMessage(ctx context.Context, client *http.Client, payload SlackRequest) (string, error) {
+	apiURL := n.APIURL
+	if apiURL == "" {
+		apiURL = "https://slack.com/api"
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("序列化请求失败: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(apiURL, "/")+"/chat.postMessage", bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+n.Token)
+	body, err := doRequest(client, req)
+	if err != nil {
+		return "", err
+	}
+
+	var resp SlackResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("解析响应失败: %v", err)
+	}
+	if !resp.OK {
+		err := fmt.Errorf("Slack 返回错误 %s: %w", resp.Error, &HTTPError{StatusCode: http.StatusOK, Body: string(body)})
+		if slackPermanentErrors[resp.Error] {
+			return "", &permanentError{err}
+		}
+		return "", err
+	}
+	return resp.TS, nil
+}
+
+// slackBlocks Block Kit 格式：标题、字段两列展示、正文
+func slackBlocks(msg *Message) []interface{} {
+	blocks := []interface{}{
+		map[string]interface{}{
+			"type": "header",
+			"text": map[string]interface{}{"type": "plain_text", "text": msg.Title},
+		},
+	}
+	if fields := richFields(msg); len(fields) > 0 {
+		var items []interface{}
+		for _, f := range fields {
+			value := escapeSlack(f.Value)
+			if f.Code {
+				value = "`" + value + "`"
+			}
+			items = append(items, map[string]interface{}{"type": "mrkdwn", "text": fmt.Sprintf("*%s*\n%s", f.Label, value)})
+		}
+		// section 最多 10 个字段
+		if len(items) > 10 {
+			items = items[:10]
+		}
+		blocks = append(blocks, map[string]interface{}{"type": "section", "fields": items})
+	}
+	if body := richBody(msg); body != "" {
+		blocks = append(blocks, map[string]interface{}{
+			"type": "section",
+			"text": map[string]interface{}{"type": "mrkdwn", "text": escapeSlack(truncateRunes(2900, body))},
+		})
+	}
+	return blocks
+}
+
+// escapeSlack Slack mrkdwn 只需要转义 & < >
+func escapeSlack(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
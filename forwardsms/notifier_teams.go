@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterNotifier("teams", func() Notifier { return &TeamsNotifier{} })
+}
+
+// TeamsNotifier Microsoft Teams，支持旧版 Office 365 connector 和 Workflows (Power Automate) 的 webhook 地址，
+// 两者都接受 Adaptive Card 附件格式的消息
+type TeamsNotifier struct {
+	URL   string `yaml:"url" required:"true" doc:"Teams webhook 地址，Office 365 connector (webhook.office.com) 或 Workflows (logic.azure.com / powerplatform.com)"`
+	Proxy string `yaml:"proxy" doc:"代理地址，如 http://127.0.0.1:8080 或 socks5://127.0.0.1:1080，可选"`
+}
+
+// TeamsRequest 包含 Adaptive Card 附件的消息
+type TeamsRequest struct {
+	Type        string            `json:"type"`
+	Attachments []TeamsAttachment `json:"attachments"`
+}
+
+// TeamsAttachment 消息附件
+type TeamsAttachment struct {
+	ContentType string                 `json:"contentType"`
+	ContentURL  *string                `json:"contentUrl"`
+	Content     map[string]interface{} `json:"content"`
+}
+
+func (n *TeamsNotifier) Validate() error {
+	u, err := url.Parse(n.URL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("webhook 地址格式错误: %s", n.URL)
+	}
+	return validateProxy(n.Proxy)
+}
+
+func (n *TeamsNotifier) Send(ctx context.Context, msg *Message) error {
+	payload := TeamsRequest{
+		Type: "message",
+		Attachments: []TeamsAttachment{{
+			ContentType: "application/vnd.microsoft.card.adaptive",
+			Content:     teamsCard(msg),
+		}},
+	}
+	client := newHTTPClient(30*time.Second, n.Proxy)
+	body, err := postJSON(ctx, client, n.URL, payload)
+
+	// webhook 已删除、connector 已停用或卡片格式错误时重试也不会成功
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode >= 400 && httpErr.StatusCode < 500 && httpErr.StatusCode != http.StatusTooManyRequests {
+		return &permanentError{err}
+	}
+	if err != nil {
+		return err
+	}
+	// 旧版 connector 成功时返回 "1"，Workflows 返回 202 和空内容。
+	// connector 失败时状态码也可能是 200，内容为错误说明，如 Webhook message delivery failed with error: ...
+	if text := strings.TrimSpace(string(body)); text != "" && text != "1" {
+		return fmt.Errorf("Teams 返回错误: %s", text)
+	}
+	return nil
+}
+
+// teamsCard 生成 Adaptive Card：标题、验证码、字段列表、正文。Workflows 最高支持 1.4 版本
+func teamsCard(msg *Message) map[string]interface{} {
+	color := "Accent"
+	if msg.Data != nil && msg.Data.Call {
+		color = "Warning"
+	}
+	body := []interface{}{
+		map[string]interface{}{"type": "TextBlock", "text": msg.Title, "weight": "Bolder", "size": "Medium", "color": color, "wrap": true},
+	}
+	var facts []interface{}
+	for _, f := range richFields(msg) {
+		if f.Code {
+			// 验证码单独大字号显示，方便在手机上查看和长按复制。只有含验证码关键字的短信才有这一项
+			body = append(body, map[string]interface{}{
+				"type": "TextBlock", "text": f.Value, "fontType": "Monospace", "size": "ExtraLarge", "weight": "Bolder", "color": "Attention",
+			})
+		}
+		facts = append(facts, map[string]interface{}{"title": f.Label, "value": f.Value})
+	}
+	if len(facts) > 0 {
+		body = append(body, map[string]interface{}{"type": "FactSet", "facts": facts})
+	}
+	if text := richBody(msg); text != "" {
+		body = append(body, map[string]interface{}{"type": "TextBlock", "text": text, "wrap": true, "separator": true})
+	}
+	return map[string]interface{}{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"msteams": map[string]interface{}{"width": "Full"},
+		"body":    body,
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	RegisterNotifier("telegram", func() Notifier { return &TelegramNotifier{} })
+}
+
+// TelegramRequest Telegram 发送消息请求结构
+type TelegramRequest struct {
+	ChatID              string               `json:"chat_id"`
+	MessageThreadID     int                  `json:"message_thread_id,omitempty"`
+	Text                string               `json:"text"`
+	ParseMode           string               `json:"parse_mode,omitempty"`
+	DisableNotification bool                 `json:"disable_notification,omitempty"`
+	ReplyMarkup         *TelegramReplyMarkup `json:"reply_markup,omitempty"`
+}
+
+// TelegramReplyMarkup 消息下方的按钮
+type TelegramReplyMarkup struct {
+	InlineKeyboard [][]TelegramButton `json:"inline_keyboard"`
+}
+
+// TelegramButton 内联按钮，copy_text 点击后复制文本 (Bot API 7.11)
+type TelegramButton struct {
+	Text     string            `json:"text"`
+	CopyText *TelegramCopyText `json:"copy_text,omitempty"`
+}
+
+// TelegramCopyText 按钮复制的内容
+type TelegramCopyText struct {
+	Text string `json:"text"`
+}
+
+// TelegramResponse Bot API 的响应，ok 为 false 时 description 为错误原因
+type TelegramResponse struct {
+	OK          bool   `json:"ok"`
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+}
+
+// TelegramNotifier Telegram 机器人，支持代理和自建 Bot API 服务
+type TelegramNotifier struct {
+	BotToken            string `yaml:"bot_token" required:"true" doc:"机器人 token"`
+	ChatID              string `yaml:"chat_id" required:"true" doc:"接收消息的 chat_id，群组以 -100 开头"`
+	MessageThreadID     int    `yaml:"message_thread_id" doc:"开启了话题的群组中，发到指定话题"`
+	DisableNotification bool   `yaml:"disable_notification" doc:"静默发送，接收方不响铃，适合不重要的规则"`
+	CopyCode            bool   `yaml:"copy_code" doc:"识别到验证码时在消息下方添加 复制验证码 按钮"`
+	APIURL              string `yaml:"api_url" default:"https://api.telegram.org" doc:"Bot API 地址，使用自建 Bot API 服务时修改"`
+	Proxy               string `yaml:"proxy" doc:"代理地址，如 http://127.0.0.1:8080 或 socks5://127.0.0.1:1080，可选"`
+	Format              string `yaml:"format" enum:"text,markdown,html" default:"text" doc:"消息格式: text 纯文本, markdown (MarkdownV2), html；后两种发送人、验证码和正文分开展示"`
+	ParseMode           string `yaml:"parse_mode" enum:"MarkdownV2,HTML,Markdown" doc:"按指定方式解析消息内容，不做转义，需要配置 template 并自己在模板中编写标记，短信内容用 escapeMarkdownV2 或 html 转义；与 format 只能配置一个"`
+}
+
+func (n *TelegramNotifier) Validate() error {
+	if err := checkEnum("format", n.Format, "text", "markdown", "html"); err != nil {
+		return err
+	}
+	if err := checkEnum("parse_mode", n.ParseMode, "MarkdownV2", "HTML", "Markdown"); err != nil {
+		return err
+	}
+	if n.ParseMode != "" && n.Format != "" && n.Format != "text" {
+		return fmt.Errorf("format 和 parse_mode 只能配置一个")
+	}
+	if n.APIURL != "" {
+		if u, err := url.Parse(n.APIURL); err != nil || u.Host == "" {
+			return fmt.Errorf("api_url 应为 http/https 地址: %s", n.APIURL)
+		}
+	}
+	return validateProxy(n.Proxy)
+}
+
+// requiresTemplate 默认内容中的 . - ( < 等字符未转义，Telegram 会返回 400，parse_mode 只能用于自定义模板
+func (n *TelegramNotifier) requiresTemplate() string {
+	if n.ParseMode != "" {
+		return "parse_mode 不会转义消息内容，需要配置 template 并用 escapeMarkdownV2 或 html 转义短信内容；只想分开展示字段请使用 format"
+	}
+	return ""
+}
+
+func (n *TelegramNotifier) apiURL() string {
+	if n.APIURL == "" {
+		return "https://api.telegram.org"
+	}
+	return strings.TrimSuffix(n.APIURL, "/")
+}
+
+func (n *TelegramNotifier) Send(ctx context.Context, msg *Message) error {
+	apiURL := fmt.Sprintf("%s/bot%s/sendMessage", n.apiURL(), n.BotToken)
+
+	tgMsg := TelegramRequest{
+		ChatID:              n.ChatID,
+		MessageThreadID:     n.MessageThreadID,
+		Text:                msg.Content,
+		ParseMode:           n.ParseMode,
+		DisableNotification: n.DisableNotification,
+	}
+	switch n.Format {
+	case "markdown":
+		tgMsg.Text, tgMsg.ParseMode = telegramMarkdownV2.render(msg), "MarkdownV2"
+	case "html":
+		tgMsg.Text, tgMsg.ParseMode = telegramHTML.render(msg), "HTML"
+	}
+	if n.CopyCode {
+		var code string
+		if msg.Data != nil {
+			code = msg.Data.verificationCode()
+		} else {
+			code = detectVerificationCode(msg.Content)
+		}
+		if code != "" {
+			tgMsg.ReplyMarkup = &TelegramReplyMarkup{InlineKeyboard: [][]TelegramButton{{
+				{Text: "复制验证码 " + code, CopyText: &TelegramCopyText{Text: code}},
+			}}}
+		}
+	}
+
+	// 创建HTTP客户端，支持代理
+	client := newHTTPClient(30*time.Second, n.Proxy)
+	if n.Proxy != "" {
+		log.Infof("使用代理发送Telegram消息: %s", n.Proxy)
+	}
+
+	_, err := postJSON(ctx, client, apiURL, tgMsg)
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		return redactToken(err, n.BotToken)
+	}
+	var resp TelegramResponse
+	if json.Unmarshal([]byte(httpErr.Body), &resp) == nil && resp.Description != "" {
+		err = fmt.Errorf("Telegram 返回错误: %d %s: %w", resp.ErrorCode, resp.Description, httpErr)
+	}
+	// token 错误、chat 或话题不存在、标记解析失败等重试也不会成功
+	if httpErr.StatusCode >= 400 && httpErr.StatusCode < 500 && httpErr.StatusCode != http.StatusTooManyRequests {
+		return &permanentError{err}
+	}
+	return err
+}
+
+// redactToken 网络错误中包含请求地址，隐藏其中的 bot token，避免写入日志和死信
+func redactToken(err error, token string) error {
+	if err == nil || token == "" || !strings.Contains(err.Error(), token) {
+		return err
+	}
+	return errors.New(strings.ReplaceAll(err.Error(), token, "<bot_token>"))
+}
@@ -0,0 +1,1103 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"go.yaml.in/yaml/v3"
+)
+
+func TestWechatNotifierSend(t *testing.T) {
+	var got map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		if got["msgtype"] != "text" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	n := &WechatNotifier{URL: srv.URL}
+	if err := n.Send(context.Background(), &Message{Title: "短信通知", Content: "hello"}); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+	text := got["text"].(map[string]interface{})["content"]
+	if text != "短信通知\nhello" {
+		t.Fatalf("消息内容错误: %v", text)
+	}
+
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	err := n.Send(context.Background(), &Message{})
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadGateway {
+		t.Fatalf("应返回 HTTPError, 实际: %v", err)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var req *http.Request
+	var body []byte
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	msg := (&Rule{Name: "hook"}).buildMessage(&MessageData{Number: "10086", Text: `验证码 "123456"`, Code: "123456"})
+
+	n := &WebhookNotifier{
+		URL:     srv.URL + "/hook?a=1",
+		Method:  "PUT",
+		Headers: map[string]string{"X-Sender": "{{.Number}}"},
+		Query:   map[string]string{"code": "{{.Code}}"},
+		Body:    `{"text": {{json .Text}}, "title": {{json .Title}}}`,
+		Secret:  "s3cret",
+	}
+	if err := n.Validate(); err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	if err := n.Send(context.Background(), msg); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+	if req.Method != "PUT" || req.URL.Query().Get("a") != "1" || req.URL.Query().Get("code") != "123456" {
+		t.Errorf("请求地址错误: %s %s", req.Method, req.URL)
+	}
+	if req.Header.Get("X-Sender") != "10086" || req.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("请求头错误: %v", req.Header)
+	}
+	if want := `{"text": "验证码 \"123456\"", "title": "短信通知"}`; string(body) != want {
+		t.Errorf("请求体: %s, 期望 %s", body, want)
+	}
+	if sig := req.Header.Get("X-Signature-256"); sig != "sha256="+signHMAC("s3cret", body) {
+		t.Errorf("签名错误: %s", sig)
+	}
+
+	form := &WebhookNotifier{URL: srv.URL, BodyType: "form", Form: map[string]string{"msg": "{{.Number}}: {{.Text}}"}, ExpectStatus: []int{202}}
+	if err := form.Validate(); err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	status = http.StatusAccepted
+	if err := form.Send(context.Background(), msg); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+	if values, _ := url.ParseQuery(string(body)); values.Get("msg") != `10086: 验证码 "123456"` {
+		t.Errorf("表单内容错误: %s", body)
+	}
+	status = http.StatusOK
+	var httpErr *HTTPError
+	if err := form.Send(context.Background(), msg); !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusOK {
+		t.Errorf("非预期状态码应返回 HTTPError: %v", err)
+	}
+
+	for _, bad := range []*WebhookNotifier{
+		{URL: "ftp://x"},
+		{URL: srv.URL, Method: "FETCH"},
+		{URL: srv.URL, Body: "{{.Sender}}"},
+		{URL: srv.URL, Headers: map[string]string{"X": "{{"}},
+		{URL: srv.URL, ExpectStatus: []int{99}},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("应返回错误: %#v", bad)
+		}
+	}
+}
+
+func TestSlackNotifierThread(t *testing.T) {
+	threads := slackThreads
+	slackThreads = &slackThreadStore{threads: map[string]*slackThread{}}
+	defer func() { slackThreads = threads }()
+
+	var requests []SlackRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat.postMessage" || r.Header.Get("Authorization") != "Bearer xoxb-test" {
+			json.NewEncoder(w).Encode(SlackResponse{Error: "invalid_auth"})
+			return
+		}
+		var req SlackRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+		json.NewEncoder(w).Encode(SlackResponse{OK: true, TS: fmt.Sprintf("1700000000.%06d", len(requests))})
+	}))
+	defer srv.Close()
+
+	n := &SlackNotifier{Token: "xoxb-test", Channel: "C123", APIURL: srv.URL}
+	if err := n.Validate(); err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	send := func(sender string) {
+		msg := (&Rule{}).buildMessage(&MessageData{Number: sender, Text: "验证码 123456", Code: "123456"})
+		if err := n.Send(context.Background(), msg); err != nil {
+			t.Fatalf("发送失败: %v", err)
+		}
+	}
+	send("10086")
+	send("10086")
+	send("95588")
+	send("10086")
+	// 热加载后创建的新实例继续回复到原来的话题
+	n = &SlackNotifier{Token: "xoxb-test", Channel: "C123", APIURL: srv.URL}
+	if err := n.Validate(); err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	send("10086")
+	want := []string{"", "1700000000.000001", "", "", "1700000000.000004"}
+	if len(requests) != len(want) {
+		t.Fatalf("请求数: %d, 期望: %d", len(requests), len(want))
+	}
+	for i, req := range requests {
+		if req.ThreadTS != want[i] || req.Channel != "C123" || len(req.Blocks) != 3 {
+			t.Errorf("第 %d 条请求: thread_ts=%q channel=%q blocks=%d", i+1, req.ThreadTS, req.Channel, len(req.Blocks))
+		}
+	}
+
+	bad := &SlackNotifier{Token: "xoxb-wrong", Channel: "C123", APIURL: srv.URL}
+	var perm *permanentError
+	var httpErr *HTTPError
+	if err := bad.Send(context.Background(), &Message{Title: "短信通知"}); !errors.As(err, &perm) || !errors.As(err, &httpErr) || !strings.Contains(httpErr.Body, "invalid_auth") {
+		t.Errorf("invalid_auth 应为不重试的错误且包含响应内容: %v", err)
+	}
+	for _, n := range []*SlackNotifier{{}, {Token: "x"}, {Token: "x", WebhookURL: "http://x"}, {WebhookURL: "http://x", ThreadWindow: "ten"}} {
+		if err := n.Validate(); err == nil {
+			t.Errorf("应返回错误: %#v", n)
+		}
+	}
+}
+
+func TestDiscordNotifierRateLimit(t *testing.T) {
+	var calls int
+	var got DiscordRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"message": "You are being rate limited.", "retry_after": 0.05, "global": false}`))
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	n := &DiscordNotifier{URL: srv.URL}
+	msg := (&Rule{Name: "验证码"}).buildMessage(&MessageData{RuleName: "验证码", Number: "10086", PhoneID: "SMS1", Time: "2024-01-01 12:00:00", Text: "验证码 123456", Code: "123456"})
+	if err := n.Send(context.Background(), msg); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("限流后应重试一次，实际请求 %d 次", calls)
+	}
+	embed := got.Embeds[0]
+	if embed.Title != "验证码" || len(embed.Fields) != 4 || embed.Fields[3].Value != "`123456`" {
+		t.Fatalf("embed 内容错误: %+v", embed)
+	}
+
+	// 没有验证码关键字时，卡号尾号等数字不作为验证码展示
+	plain := discordEmbed(&Message{Data: &MessageData{Number: "95588", Text: "您尾号1234的卡消费2000元", Code: "1234"}})
+	for _, f := range plain.Fields {
+		if f.Name == "验证码" {
+			t.Fatalf("不应显示验证码: %+v", plain.Fields)
+		}
+	}
+
+	// 等待时间过长时交给投递队列重试
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"retry_after": 60}`))
+	})
+	var httpErr *HTTPError
+	if err := n.Send(context.Background(), msg); !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("应返回 429 错误: %v", err)
+	}
+}
+
+func TestNtfyNotifier(t *testing.T) {
+	var got NtfyRequest
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	n := &NtfyNotifier{
+		Server:   srv.URL,
+		Topic:    "sms",
+		Priority: 4,
+		Tags:     []string{"speech_balloon"},
+		Token:    "tk_test",
+		Click:    "sms:{{.Number}}",
+		Actions:  []NtfyAction{{Action: "view", Label: "打开", URL: "https://example.com"}},
+		CopyCode: true,
+	}
+	if err := n.Validate(); err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	msg := (&Rule{}).buildMessage(&MessageData{Number: "10086", Text: "您的验证码 123456", Code: "123456"})
+	if err := n.Send(context.Background(), msg); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+	if auth != "Bearer tk_test" || got.Topic != "sms" || got.Priority != 4 || got.Click != "sms:10086" {
+		t.Errorf("请求内容错误: %s %+v", auth, got)
+	}
+	if len(got.Actions) != 2 || got.Actions[1].Action != "copy" || got.Actions[1].Value != "123456" {
+		t.Errorf("应添加复制验证码按钮: %+v", got.Actions)
+	}
+
+	// 没有验证码关键字时不添加复制按钮
+	if err := n.Send(context.Background(), (&Rule{}).buildMessage(&MessageData{Number: "10086", Text: "订单 123456 已发货"})); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+	if len(got.Actions) != 1 {
+		t.Errorf("不应添加复制按钮: %+v", got.Actions)
+	}
+
+	for _, bad := range []*NtfyNotifier{
+		{Topic: "a", Priority: 6},
+		{Topic: "a", Token: "tk", Username: "u"},
+		{Topic: "a", Actions: []NtfyAction{{Action: "view", Label: "x"}}},
+		{Topic: "a", Actions: []NtfyAction{{Action: "open", Label: "x"}}},
+		{Topic: "a", Click: "{{.Sender}}"},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("应返回错误: %#v", bad)
+		}
+	}
+}
+
+func TestPushoverEmergencyReceipt(t *testing.T) {
+	var form url.Values
+	acknowledged := 0
+	lookups := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/messages.json":
+			r.ParseForm()
+			form = r.PostForm
+			if form.Get("token") != "app" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"status":0,"errors":["application token is invalid"]}`))
+				return
+			}
+			w.Write([]byte(`{"status":1,"request":"req1","receipt":"rcpt1"}`))
+		case r.URL.Path == "/receipts/rcpt1.json" && r.URL.Query().Get("token") == "app":
+			fmt.Fprintf(w, `{"status":1,"acknowledged":%d,"acknowledged_at":1700000000,"acknowledged_by_device":"iphone","expired":0}`, acknowledged)
+		case strings.HasPrefix(r.URL.Path, "/receipts/"):
+			lookups[r.URL.Path]++
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"status":0,"errors":["receipt not found"]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	tracker := pushoverReceipts
+	pushoverReceipts = &receiptTracker{limit: 10, interval: time.Hour, maxFailures: 3}
+	defer func() { pushoverReceipts = tracker }()
+
+	n := &PushoverNotifier{Token: "app", User: "user", Priority: 2, Retry: 30, Sound: "siren", APIURL: srv.URL}
+	if err := n.Validate(); err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	msg := (&Rule{}).buildMessage(&MessageData{RuleName: "bank", Number: "95588", Text: "大额转出"})
+	if err := n.Send(context.Background(), msg); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+	if form.Get("priority") != "2" || form.Get("retry") != "30" || form.Get("expire") != "3600" || form.Get("sound") != "siren" {
+		t.Errorf("请求参数错误: %v", form)
+	}
+
+	pushoverReceipts.refresh(context.Background())
+	if list := pushoverReceipts.List(); len(list) != 1 || list[0].Rule != "bank" || list[0].Acknowledged {
+		t.Fatalf("回执状态错误: %+v", list)
+	}
+	acknowledged = 1
+	pushoverReceipts.refresh(context.Background())
+	if r := pushoverReceipts.List()[0]; !r.Acknowledged || r.AcknowledgedBy != "iphone" || r.AcknowledgedAt.Unix() != 1700000000 {
+		t.Fatalf("应已确认: %+v", r)
+	}
+
+	// 一直查询失败的回执在连续失败 maxFailures 次后放弃，已过提醒时间的失败一次即放弃
+	now := time.Now()
+	pushoverReceipts.Track(&PushoverReceipt{Receipt: "gone", CreatedAt: now, ExpiresAt: now.Add(time.Hour), token: "app", apiURL: srv.URL})
+	pushoverReceipts.Track(&PushoverReceipt{Receipt: "old", CreatedAt: now, ExpiresAt: now.Add(-time.Minute), token: "app", apiURL: srv.URL})
+	for i := 0; i < 5; i++ {
+		pushoverReceipts.refresh(context.Background())
+	}
+	if lookups["/receipts/gone.json"] != 3 || lookups["/receipts/old.json"] != 1 {
+		t.Fatalf("放弃后不应继续查询: %v", lookups)
+	}
+	for _, r := range pushoverReceipts.List() {
+		if r.Receipt != "rcpt1" && (!r.Abandoned || r.LastError == "") {
+			t.Fatalf("回执应已放弃并保留错误: %+v", r)
+		}
+	}
+
+	var perm *permanentError
+	bad := &PushoverNotifier{Token: "wrong", User: "user", APIURL: srv.URL}
+	if err := bad.Send(context.Background(), msg); !errors.As(err, &perm) {
+		t.Errorf("token 错误不应重试: %v", err)
+	}
+	for _, bad := range []*PushoverNotifier{{Priority: 3}, {Priority: 2, Retry: 10}, {Priority: 2, Expire: 20000}} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("应返回错误: %#v", bad)
+		}
+	}
+}
+
+func TestServerChanEndpoint(t *testing.T) {
+	for key, want := range map[string]string{
+		"sctp1234tabcd": "https://1234.push.ft07.com/send/sctp1234tabcd.send",
+		"SCT5678abcd":   "https://sctapi.ftqq.com/SCT5678abcd.send",
+		"SCU9999abcd":   "https://sc.ftqq.com/SCU9999abcd.send",
+	} {
+		if got := (&ServerChanNotifier{SendKey: key}).endpoint(); got != want {
+			t.Errorf("%s: %s, 期望 %s", key, got, want)
+		}
+	}
+}
+
+// 两个渠道出错时 HTTP 状态码仍为 200，需要检查响应中的 code
+func TestJSONCodeNotifiers(t *testing.T) {
+	var response string
+	var got url.Values
+	var gotJSON map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") == "application/json" {
+			json.NewDecoder(r.Body).Decode(&gotJSON)
+		} else {
+			r.ParseForm()
+			got = r.PostForm
+		}
+		w.Write([]byte(response))
+	}))
+	defer srv.Close()
+
+	msg := (&Rule{}).buildMessage(&MessageData{Number: "10086", Text: "验证码 123456", Code: "123456"})
+	cases := []struct {
+		name     string
+		notifier Notifier
+		response string
+		ok       bool
+	}{
+		{"Server酱成功", &ServerChanNotifier{SendKey: "SCTxxx", APIURL: srv.URL}, `{"code":0,"message":"","data":{}}`, true},
+		{"Server酱 key 错误", &ServerChanNotifier{SendKey: "SCTxxx", APIURL: srv.URL}, `{"code":40001,"message":"bad pushkey"}`, false},
+		{"Server酱旧版", &ServerChanNotifier{SendKey: "SCUxxx", APIURL: srv.URL}, `{"errno":1024,"errmsg":"不要重复发送同样的内容"}`, false},
+		{"Server酱非 JSON", &ServerChanNotifier{SendKey: "SCTxxx", APIURL: srv.URL}, `<html>`, false},
+		{"PushPlus 成功", &PushPlusNotifier{Token: "t", Topic: "g1", Template: "markdown", APIURL: srv.URL}, `{"code":200,"msg":"请求成功","data":"x"}`, true},
+		{"PushPlus token 错误", &PushPlusNotifier{Token: "t", APIURL: srv.URL}, `{"code":903,"msg":"无效的用户令牌"}`, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			response = c.response
+			err := c.notifier.Send(context.Background(), msg)
+			if (err == nil) != c.ok {
+				t.Fatalf("结果: %v, 期望成功: %v", err, c.ok)
+			}
+		})
+	}
+	if !strings.Contains(got.Get("desp"), "`123456`") || got.Get("title") != "10086" {
+		t.Errorf("Server酱请求内容错误: %v", got)
+	}
+	if gotJSON["template"] != "html" || !strings.Contains(gotJSON["content"].(string), "<code>123456</code>") {
+		t.Errorf("PushPlus 请求内容错误: %v", gotJSON)
+	}
+}
+
+func TestWecomAppNotifierToken(t *testing.T) {
+	var tokenCalls int
+	var got WecomAppRequest
+	current := "token1"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cgi-bin/gettoken":
+			tokenCalls++
+			if r.URL.Query().Get("corpsecret") != "secret" {
+				w.Write([]byte(`{"errcode":40001,"errmsg":"invalid credential"}`))
+				return
+			}
+			fmt.Fprintf(w, `{"errcode":0,"errmsg":"ok","access_token":%q,"expires_in":7200}`, current)
+		case "/cgi-bin/message/send":
+			if r.URL.Query().Get("access_token") != current {
+				w.Write([]byte(`{"errcode":42001,"errmsg":"access_token expired"}`))
+				return
+			}
+			json.NewDecoder(r.Body).Decode(&got)
+			switch got.ToUser {
+			case "nobody":
+				w.Write([]byte(`{"errcode":81013,"errmsg":"user & party & tag all invalid"}`))
+			case "busy":
+				w.Write([]byte(`{"errcode":45009,"errmsg":"api freq out of limit"}`))
+			default:
+				w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+			}
+		}
+	}))
+	defer srv.Close()
+
+	cache := wecomTokens
+	wecomTokens = &wecomTokenCache{tokens: map[string]wecomToken{}}
+	defer func() { wecomTokens = cache }()
+
+	n := &WecomAppNotifier{CorpID: "corp", CorpSecret: "secret", AgentID: 1000002, ToUser: "zhangsan|lisi", APIURL: srv.URL}
+	if err := n.Validate(); err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	msg := &Message{Title: "短信通知", Content: "hello"}
+	for i := 0; i < 2; i++ {
+		if err := n.Send(context.Background(), msg); err != nil {
+			t.Fatalf("发送失败: %v", err)
+		}
+	}
+	if tokenCalls != 1 {
+		t.Errorf("access_token 应缓存，实际获取 %d 次", tokenCalls)
+	}
+	if got.ToUser != "zhangsan|lisi" || got.AgentID != 1000002 || got.Text.Content != "短信通知\nhello" {
+		t.Errorf("请求内容错误: %+v", got)
+	}
+
+	// token 在有效期内失效时重新获取
+	current = "token2"
+	if err := n.Send(context.Background(), msg); err != nil {
+		t.Fatalf("刷新 token 后发送失败: %v", err)
+	}
+	if tokenCalls != 2 {
+		t.Errorf("应重新获取 access_token，实际获取 %d 次", tokenCalls)
+	}
+
+	bad := &WecomAppNotifier{CorpID: "corp", CorpSecret: "wrong", AgentID: 1, ToUser: "@all", APIURL: srv.URL}
+	var perm *permanentError
+	if err := bad.Send(context.Background(), msg); !errors.As(err, &perm) {
+		t.Errorf("secret 错误不应重试: %v", err)
+	}
+	// 状态码为 200 的错误也在死信中保留响应内容，接收人全部无效不重试，限流继续重试
+	var httpErr *HTTPError
+	n.ToUser = "nobody"
+	if err := n.Send(context.Background(), msg); !errors.As(err, &perm) || !errors.As(err, &httpErr) || !strings.Contains(httpErr.Body, "81013") {
+		t.Errorf("接收人无效不应重试且应包含响应内容: %v", err)
+	}
+	n.ToUser = "busy"
+	if err := n.Send(context.Background(), msg); err == nil || errors.As(err, &perm) || !errors.As(err, &httpErr) {
+		t.Errorf("限流应重试且应包含响应内容: %v", err)
+	}
+	if err := (&WecomAppNotifier{CorpID: "c", CorpSecret: "s", AgentID: 1}).Validate(); err == nil {
+		t.Error("缺少接收人应返回错误")
+	}
+}
+
+func TestDingtalkFeishuSign(t *testing.T) {
+	now := time.UnixMilli(1700000000123)
+	n := &DingtalkNotifier{URL: "https://oapi.dingtalk.com/robot/send?access_token=abc", Secret: "SECxxx"}
+	signed, err := n.signedURL(now)
+	if err != nil {
+		t.Fatalf("签名失败: %v", err)
+	}
+	u, _ := url.Parse(signed)
+	if u.Query().Get("access_token") != "abc" || u.Query().Get("timestamp") != "1700000000123" {
+		t.Fatalf("签名地址错误: %s", signed)
+	}
+	// 钉钉文档中的算法: Base64(HmacSHA256(secret, timestamp + "\n" + secret))
+	if sign := u.Query().Get("sign"); sign != "3SlsNji4YhJUBndPoWzM1U972tbuIfWjmIJWmMNMH1E=" {
+		t.Errorf("钉钉签名: %s", sign)
+	}
+	ts, sign := feishuSign("secret", now)
+	if ts != "1700000000" || sign != "fiWS2+gh28DOydAv7hzONH/mDn9+b1Y4Y5ivXWXy8vA=" {
+		t.Errorf("飞书签名: %s %s", ts, sign)
+	}
+}
+
+func TestDingtalkFeishuErrCode(t *testing.T) {
+	var response string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(response))
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		name      string
+		notifier  Notifier
+		response  string
+		ok        bool
+		permanent bool
+	}{
+		{"钉钉成功", &DingtalkNotifier{URL: srv.URL, Secret: "SEC"}, `{"errcode":0,"errmsg":"ok"}`, true, false},
+		{"钉钉签名错误", &DingtalkNotifier{URL: srv.URL, Secret: "SEC"}, `{"errcode":310000,"errmsg":"sign not match"}`, false, true},
+		{"钉钉限流", &DingtalkNotifier{URL: srv.URL}, `{"errcode":410100,"errmsg":"send too fast"}`, false, false},
+		{"飞书成功", &FeishuNotifier{URL: srv.URL, Secret: "s"}, `{"code":0,"msg":"success","data":{}}`, true, false},
+		{"飞书旧版成功", &FeishuNotifier{URL: srv.URL}, `{"Extra":null,"StatusCode":0,"StatusMessage":"success"}`, true, false},
+		{"飞书签名错误", &FeishuNotifier{URL: srv.URL, Secret: "s"}, `{"code":19021,"msg":"sign match fail or timestamp is not within one hour from current time"}`, false, true},
+		{"飞书限流", &FeishuNotifier{URL: srv.URL}, `{"code":11232,"msg":"frequency limited"}`, false, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			response = c.response
+			err := c.notifier.Send(context.Background(), &Message{Title: "短信通知", Content: "hello"})
+			if (err == nil) != c.ok {
+				t.Fatalf("结果: %v, 期望成功: %v", err, c.ok)
+			}
+			if err == nil {
+				return
+			}
+			// 响应内容随错误写入投递记录，方便排查
+			var httpErr *HTTPError
+			if !errors.As(err, &httpErr) || httpErr.Body != c.response {
+				t.Fatalf("错误应包含响应内容: %v", err)
+			}
+			var perm *permanentError
+			if errors.As(err, &perm) != c.permanent {
+				t.Fatalf("不重试: %v, 期望: %v", errors.As(err, &perm), c.permanent)
+			}
+		})
+	}
+}
+
+func TestMatrixNotifier(t *testing.T) {
+	var paths []string
+	var got MatrixMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer syt_token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"errcode":"M_UNKNOWN_TOKEN","error":"Invalid access token"}`))
+			return
+		}
+		paths = append(paths, r.Method+" "+r.URL.EscapedPath())
+		if r.Method == http.MethodGet {
+			// 房间未开启加密
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errcode":"M_NOT_FOUND","error":"Event not found"}`))
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"event_id":"$abc"}`))
+	}))
+	defer srv.Close()
+
+	n := &MatrixNotifier{Homeserver: srv.URL + "/", AccessToken: "syt_token", RoomID: "!room:example.com", CheckEncryption: true}
+	if err := n.Validate(); err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	msg := &Message{Title: "短信通知", Content: "a<b>", Body: "a<b>", Data: &MessageData{Number: "10086", Text: "验证码 123456", Code: "123456"}}
+	ctx := context.WithValue(context.Background(), deliveryIDKey{}, "0123abcd-42")
+	for i := 0; i < 2; i++ {
+		if err := n.Send(ctx, msg); err != nil {
+			t.Fatalf("发送失败: %v", err)
+		}
+	}
+	want := []string{
+		"GET /_matrix/client/v3/rooms/%21room:example.com/state/m.room.encryption/",
+		"PUT /_matrix/client/v3/rooms/%21room:example.com/send/m.room.message/forwardsms-0123abcd-42",
+		"PUT /_matrix/client/v3/rooms/%21room:example.com/send/m.room.message/forwardsms-0123abcd-42",
+	}
+	if strings.Join(paths, "\n") != strings.Join(want, "\n") {
+		t.Errorf("请求路径错误，加密状态只应检查一次，重试应使用相同的事务 ID:\n%s", strings.Join(paths, "\n"))
+	}
+	if got.MsgType != "m.text" || got.Body != "短信通知\na<b>" || got.Format != "org.matrix.custom.html" {
+		t.Errorf("消息内容错误: %+v", got)
+	}
+	if !strings.Contains(got.FormattedBody, "a&lt;b&gt;") || !strings.Contains(got.FormattedBody, "<code>123456</code>") {
+		t.Errorf("HTML 内容错误: %s", got.FormattedBody)
+	}
+
+	// 直接发送时每次使用不同的事务 ID
+	if a, b := matrixTxnID(context.Background()), matrixTxnID(context.Background()); a == b {
+		t.Errorf("事务 ID 不应重复: %s", a)
+	}
+
+	bad := &MatrixNotifier{Homeserver: srv.URL, AccessToken: "wrong", RoomID: "!room:example.com"}
+	var perm *permanentError
+	if err := bad.Send(context.Background(), msg); !errors.As(err, &perm) {
+		t.Errorf("token 无效不应重试: %v", err)
+	}
+	if err := (&MatrixNotifier{Homeserver: srv.URL, AccessToken: "t", RoomID: "#room:example.com"}).Validate(); err == nil {
+		t.Error("房间别名应返回错误")
+	}
+}
+
+// startMQTTBroker 启动内嵌的 MQTT broker，只允许 user/pass 登录，返回 tcp 地址
+func startMQTTBroker(t *testing.T) string {
+	t.Helper()
+	server := mochi.New(&mochi.Options{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	err := server.AddHook(new(auth.Hook), &auth.Options{Ledger: &auth.Ledger{
+		Auth: auth.AuthRules{{Username: "user", Password: "pass", Allow: true}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcp := listeners.NewTCP(listeners.Config{ID: "test", Address: "127.0.0.1:0"})
+	if err := server.AddListener(tcp); err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	t.Cleanup(func() { server.Close() })
+	return "tcp://" + tcp.Address()
+}
+
+func TestMQTTNotifier(t *testing.T) {
+	broker := startMQTTBroker(t)
+	n := &MQTTNotifier{Broker: broker, Topic: "sms/{phone_id}/{number}", QoS: 1, Retain: true, Username: "user", Password: "pass"}
+	if err := n.Validate(); err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	msg := &Message{Title: "短信通知", Content: "...", Data: &MessageData{
+		RuleName: "验证码", Number: "+8613800138000", Time: "2024-01-01 12:00:00", Text: "验证码 123456",
+		PhoneID: "sim1", SMSID: "42", Timestamp: "1704081600", Code: "123456",
+	}}
+	if err := n.Send(context.Background(), msg); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+
+	// 发布后再订阅，能收到保留消息说明 retain 生效
+	received := make(chan mqtt.Message, 1)
+	sub := mqtt.NewClient(mqtt.NewClientOptions().AddBroker(broker).SetClientID("sub").SetUsername("user").SetPassword("pass"))
+	if token := sub.Connect(); token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+	defer sub.Disconnect(0)
+	sub.Subscribe("sms/#", 1, func(_ mqtt.Client, m mqtt.Message) { received <- m })
+
+	select {
+	case m := <-received:
+		if m.Topic() != "sms/sim1/_8613800138000" || !m.Retained() || m.Qos() != 1 {
+			t.Errorf("主题或标志错误: topic=%s retained=%v qos=%d", m.Topic(), m.Retained(), m.Qos())
+		}
+		var got map[string]interface{}
+		json.Unmarshal(m.Payload(), &got)
+		if got["number"] != "+8613800138000" || got["text"] != "验证码 123456" || got["sms_id"] != "42" ||
+			got["timestamp"] != "1704081600" || got["rule"] != "验证码" || got["code"] != "123456" {
+			t.Errorf("消息内容错误: %s", m.Payload())
+		}
+		if _, ok := got["secret"]; ok {
+			t.Errorf("不应包含 secret: %s", m.Payload())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("没有收到消息")
+	}
+
+	call := &Message{Data: &MessageData{Call: true, Number: "10086", CallType: "missed", Duration: 3}}
+	if topic := (&MQTTNotifier{}).topic(call.Data); topic != "forwardsms/call/unknown/10086" {
+		t.Errorf("默认主题错误: %s", topic)
+	}
+	payload, _ := mqttPayload(call)
+	if string(payload) != `{"number":"10086","name":"","time":"","type":"missed","duration":3,"source":"","phone_id":"","timestamp":"","rule":""}` {
+		t.Errorf("来电消息错误: %s", payload)
+	}
+
+	// 没有验证码关键字的短信不带 code，避免卡号尾号、金额触发自动化
+	payload, _ = mqttPayload(&Message{Data: &MessageData{Number: "95588", Text: "您尾号1234的卡消费2000元", Code: "1234"}})
+	if strings.Contains(string(payload), `"code"`) {
+		t.Errorf("不应包含 code: %s", payload)
+	}
+
+	bad := &MQTTNotifier{Broker: broker, Username: "user", Password: "wrong"}
+	var perm *permanentError
+	if err := bad.Send(context.Background(), msg); !errors.As(err, &perm) {
+		t.Errorf("密码错误不应重试: %v", err)
+	}
+	for _, c := range []*MQTTNotifier{
+		{Broker: "127.0.0.1:1883"},
+		{Broker: "http://127.0.0.1:1883"},
+		{Broker: broker, QoS: 3},
+		{Broker: broker, Topic: "sms/+/{number}"},
+		{Broker: broker, Topic: "sms/{text}"},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("应返回错误: %+v", c)
+		}
+	}
+}
+
+func TestTeamsNotifier(t *testing.T) {
+	var status int
+	var response string
+	var got TeamsRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(status)
+		w.Write([]byte(response))
+	}))
+	defer srv.Close()
+
+	n := &TeamsNotifier{URL: srv.URL}
+	if err := n.Validate(); err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	msg := &Message{Title: "短信通知", Body: "验证码 123456", Data: &MessageData{Number: "10086", PhoneID: "sim1", Time: "12:00", Text: "验证码 123456", Code: "123456"}}
+	cases := []struct {
+		name      string
+		status    int
+		response  string
+		ok        bool
+		permanent bool
+	}{
+		{"connector 成功", 200, "1", true, false},
+		{"Workflows 成功", 202, "", true, false},
+		{"connector 200 错误", 200, "Webhook message delivery failed with error: Microsoft Teams endpoint returned HTTP error 413", false, false},
+		{"卡片格式错误", 400, "Bad payload received by generic incoming webhook.", false, true},
+		{"限流", 429, "Microsoft Teams endpoint returned HTTP error 429", false, false},
+	}
+	for _, c := range cases {
+		status, response = c.status, c.response
+		err := n.Send(context.Background(), msg)
+		var perm *permanentError
+		if (err == nil) != c.ok || errors.As(err, &perm) != c.permanent {
+			t.Errorf("%s: %v", c.name, err)
+		}
+	}
+
+	if len(got.Attachments) != 1 || got.Attachments[0].ContentType != "application/vnd.microsoft.card.adaptive" {
+		t.Fatalf("附件错误: %+v", got)
+	}
+	card, _ := json.Marshal(got.Attachments[0].Content)
+	for _, want := range []string{`"type":"AdaptiveCard"`, `"title":"发送人","value":"10086"`, `"title":"接收卡","value":"sim1"`, `"text":"123456"`, `"text":"验证码 123456"`} {
+		if !strings.Contains(string(card), want) {
+			t.Errorf("卡片缺少 %s: %s", want, card)
+		}
+	}
+
+	// 卡号尾号、金额等数字不应显示为验证码
+	card, _ = json.Marshal(teamsCard(&Message{Title: "短信通知", Data: &MessageData{Number: "95588", Text: "您尾号1234的卡消费2000元", Code: "1234"}}))
+	if strings.Contains(string(card), "ExtraLarge") || strings.Contains(string(card), "验证码") {
+		t.Errorf("不应显示验证码: %s", card)
+	}
+}
+
+// smtpSession 模拟 SMTP 服务器收到的一封邮件
+type smtpSession struct {
+	auth  string
+	tls   bool
+	from  string
+	rcpts []string
+	data  string
+}
+
+// startSMTPServer 启动模拟的 SMTP 服务器，只接受 user/pass 登录。
+// implicitTLS 时直接 TLS 连接，否则 cfg 不为空时支持 STARTTLS
+func startSMTPServer(t *testing.T, cfg *tls.Config, implicitTLS bool) (string, <-chan smtpSession) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if implicitTLS {
+		ln = tls.NewListener(ln, cfg)
+	}
+	t.Cleanup(func() { ln.Close() })
+	sessions := make(chan smtpSession, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, cfg, implicitTLS, sessions)
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	return port, sessions
+}
+
+func serveSMTP(conn net.Conn, cfg *tls.Config, tlsActive bool, sessions chan<- smtpSession) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	s := smtpSession{tls: tlsActive}
+	checkLogin := func(user, pass string) {
+		if user == "user" && pass == "pass" {
+			tp.PrintfLine("235 OK")
+		} else {
+			tp.PrintfLine("535 Authentication failed")
+		}
+	}
+	readBase64 := func() string {
+		line, _ := tp.ReadLine()
+		b, _ := base64.StdEncoding.DecodeString(line)
+		return string(b)
+	}
+	tp.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(cmd) {
+		case "EHLO":
+			if cfg != nil && !tlsActive {
+				tp.PrintfLine("250-fake\r\n250-STARTTLS\r\n250 AUTH PLAIN LOGIN CRAM-MD5")
+			} else {
+				tp.PrintfLine("250-fake\r\n250 AUTH PLAIN LOGIN CRAM-MD5")
+			}
+		case "STARTTLS":
+			tp.PrintfLine("220 Ready")
+			conn = tls.Server(conn, cfg)
+			tp = textproto.NewConn(conn)
+			tlsActive, s.tls = true, true
+		case "AUTH":
+			mech, initial, _ := strings.Cut(arg, " ")
+			s.auth = mech
+			switch mech {
+			case "PLAIN":
+				b, _ := base64.StdEncoding.DecodeString(initial)
+				parts := strings.Split(string(b), "\x00")
+				checkLogin(parts[1], parts[2])
+			case "LOGIN":
+				tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte("Username:")))
+				user := readBase64()
+				tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte("Password:")))
+				checkLogin(user, readBase64())
+			case "CRAM-MD5":
+				challenge := "<123@fake>"
+				tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(challenge)))
+				user, digest, _ := strings.Cut(readBase64(), " ")
+				mac := hmac.New(md5.New, []byte("pass"))
+				mac.Write([]byte(challenge))
+				if hex.EncodeToString(mac.Sum(nil)) != digest {
+					user = ""
+				}
+				checkLogin(user, "pass")
+			}
+		case "MAIL":
+			s.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			s.rcpts = append(s.rcpts, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 Go ahead")
+			data, _ := tp.ReadDotBytes()
+			s.data = string(data)
+			tp.PrintfLine("250 OK")
+			sessions <- s
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Not implemented")
+		}
+	}
+}
+
+func TestEmailNotifier(t *testing.T) {
+	srv := httptest.NewUnstartedServer(nil)
+	srv.StartTLS()
+	cfg := &tls.Config{Certificates: srv.TLS.Certificates}
+	srv.Close()
+
+	msg := &Message{Title: "短信通知 验证码", Content: "验证码 123456\n发送人: 10086", Body: "验证码 <123456>", Data: &MessageData{Number: "10086", Text: "验证码 123456", Code: "123456"}}
+	tlsPort, tlsSessions := startSMTPServer(t, cfg, true)
+	startTLSPort, startTLSSessions := startSMTPServer(t, cfg, false)
+	plainPort, plainSessions := startSMTPServer(t, nil, false)
+
+	cases := []struct {
+		name     string
+		notifier *EmailNotifier
+		sessions <-chan smtpSession
+		auth     string
+		tls      bool
+	}{
+		{"直接 TLS", &EmailNotifier{SMTPPort: tlsPort, Security: "tls", Auth: "plain"}, tlsSessions, "PLAIN", true},
+		{"STARTTLS", &EmailNotifier{SMTPPort: startTLSPort, Auth: "login"}, startTLSSessions, "LOGIN", true},
+		{"不加密", &EmailNotifier{SMTPPort: plainPort, Security: "none", Auth: "cram-md5"}, plainSessions, "CRAM-MD5", false},
+	}
+	for _, c := range cases {
+		n := c.notifier
+		n.SMTPHost, n.Username, n.Password, n.TLSInsecure = "127.0.0.1", "user", "pass", true
+		n.From = "短信转发 <sms@example.com>"
+		n.To = AddressList{"a@example.com", "张三 <b@example.com>"}
+		n.CC = AddressList{"c@example.com"}
+		n.BCC = AddressList{"d@example.com"}
+		if err := n.Validate(); err != nil {
+			t.Fatalf("%s: 校验失败: %v", c.name, err)
+		}
+		if err := n.Send(context.Background(), msg); err != nil {
+			t.Fatalf("%s: 发送失败: %v", c.name, err)
+		}
+		s := <-c.sessions
+		if s.auth != c.auth || s.tls != c.tls || s.from != "sms@example.com" {
+			t.Errorf("%s: 认证或加密错误: %+v", c.name, s)
+		}
+		if strings.Join(s.rcpts, ",") != "a@example.com,b@example.com,c@example.com,d@example.com" {
+			t.Errorf("%s: 收件人错误: %v", c.name, s.rcpts)
+		}
+	}
+
+	// 检查邮件头和正文，密送不应出现在邮件头中
+	n := &EmailNotifier{SMTPHost: "127.0.0.1", SMTPPort: plainPort, From: "sms@example.com", To: AddressList{"a@example.com"}, BCC: AddressList{"d@example.com"}}
+	if err := n.Validate(); err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	if err := n.Send(context.Background(), msg); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+	m, err := mail.ReadMessage(strings.NewReader((<-plainSessions).data))
+	if err != nil {
+		t.Fatalf("解析邮件失败: %v", err)
+	}
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject")); subject != msg.Title || !strings.HasPrefix(m.Header.Get("Subject"), "=?UTF-8?") {
+		t.Errorf("Subject 应按 RFC 2047 编码: %s", m.Header.Get("Subject"))
+	}
+	if m.Header.Get("Date") == "" || !strings.HasSuffix(m.Header.Get("Message-ID"), "@example.com>") || m.Header.Get("Bcc") != "" {
+		t.Errorf("邮件头错误: %v", m.Header)
+	}
+	mediaType, params, _ := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type 错误: %s", m.Header.Get("Content-Type"))
+	}
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	var parts []string
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		b, _ := io.ReadAll(p)
+		parts = append(parts, p.Header.Get("Content-Type")+"\n"+string(b))
+	}
+	if len(parts) != 2 || !strings.Contains(parts[0], "text/plain") || !strings.Contains(parts[0], "验证码 123456\n发送人: 10086") ||
+		!strings.Contains(parts[1], "text/html") || !strings.Contains(parts[1], "验证码 &lt;123456&gt;") {
+		t.Errorf("正文错误: %q", parts)
+	}
+
+	var perm *permanentError
+	wrong := &EmailNotifier{SMTPHost: "127.0.0.1", SMTPPort: tlsPort, Username: "user", Password: "wrong", From: "sms@example.com", To: AddressList{"a@example.com"}, TLSInsecure: true, Security: "tls"}
+	wrong.Validate()
+	if err := wrong.Send(context.Background(), msg); !errors.As(err, &perm) {
+		t.Errorf("密码错误不应重试: %v", err)
+	}
+	noTLS := &EmailNotifier{SMTPHost: "127.0.0.1", SMTPPort: plainPort, Security: "starttls", From: "sms@example.com", To: AddressList{"a@example.com"}}
+	noTLS.Validate()
+	if err := noTLS.Send(context.Background(), msg); !errors.As(err, &perm) {
+		t.Errorf("服务器不支持 STARTTLS 时不应重试: %v", err)
+	}
+	if err := (&EmailNotifier{SMTPHost: "smtp.example.com", SMTPPort: "25", Security: "none", Username: "u", From: "a@example.com", To: AddressList{"b@example.com"}}).Validate(); err == nil {
+		t.Error("不加密时使用 plain 认证应返回错误")
+	}
+}
+
+func TestAddressList(t *testing.T) {
+	var cfg struct {
+		To  AddressList `yaml:"to"`
+		CC  AddressList `yaml:"cc"`
+		BCC AddressList `yaml:"bcc"`
+	}
+	data := "to: a@example.com, b@example.com;c@example.com\ncc: [张三 <d@example.com>]\n"
+	if err := yaml.Unmarshal([]byte(data), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(cfg.To, "|") != "a@example.com|b@example.com|c@example.com" || len(cfg.CC) != 1 || cfg.BCC != nil {
+		t.Errorf("解析错误: %+v", cfg)
+	}
+}
+
+func TestTelegramNotifier(t *testing.T) {
+	var path string
+	var got TelegramRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		got = TelegramRequest{}
+		json.NewDecoder(r.Body).Decode(&got)
+		if got.MessageThreadID == 404 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: message thread not found"}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"result":{}}`))
+	}))
+	defer srv.Close()
+
+	n := &TelegramNotifier{BotToken: "123:abc", ChatID: "-100123", APIURL: srv.URL + "/", MessageThreadID: 7, DisableNotification: true, CopyCode: true, ParseMode: "HTML"}
+	if err := n.Validate(); err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	msg := &Message{Title: "短信通知", Content: "<b>123456</b>", Data: &MessageData{Text: "验证码 123456", Code: "123456"}}
+	if err := n.Send(context.Background(), msg); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+	if path != "/bot123:abc/sendMessage" {
+		t.Errorf("请求地址错误: %s", path)
+	}
+	if got.ChatID != "-100123" || got.MessageThreadID != 7 || !got.DisableNotification || got.ParseMode != "HTML" || got.Text != "<b>123456</b>" {
+		t.Errorf("请求内容错误: %+v", got)
+	}
+	if got.ReplyMarkup == nil || got.ReplyMarkup.InlineKeyboard[0][0].CopyText.Text != "123456" {
+		t.Errorf("缺少复制验证码按钮: %+v", got.ReplyMarkup)
+	}
+
+	// 没有验证码关键字时不添加按钮，卡号尾号等数字不是验证码
+	for _, d := range []*MessageData{{}, {Text: "您尾号1234的卡消费2000元", Code: "1234"}} {
+		if err := n.Send(context.Background(), &Message{Content: "你好", Data: d}); err != nil || got.ReplyMarkup != nil {
+			t.Errorf("不应添加按钮: %v %+v", err, got.ReplyMarkup)
+		}
+	}
+
+	n.MessageThreadID = 404
+	var perm *permanentError
+	if err := n.Send(context.Background(), msg); !errors.As(err, &perm) || !strings.Contains(err.Error(), "message thread not found") {
+		t.Errorf("话题不存在不应重试: %v", err)
+	}
+	// 死信中保留状态码和响应内容
+	var httpErr *HTTPError
+	if err := n.Send(context.Background(), msg); !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("错误应包含 HTTP 状态码和响应: %v", err)
+	}
+
+	down := &TelegramNotifier{BotToken: "123:secret", ChatID: "1", APIURL: "http://127.0.0.1:1"}
+	if err := down.Send(context.Background(), msg); err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("错误中不应包含 token: %v", err)
+	}
+	if err := (&TelegramNotifier{Format: "html", ParseMode: "HTML"}).Validate(); err == nil {
+		t.Error("format 和 parse_mode 同时配置应返回错误")
+	}
+
+	// parse_mode 不转义内容，默认消息中的 . - ( 会导致 Telegram 返回 400，必须配合 template 使用
+	rule := "tg:\n  type: all\n  notify: telegram\n  bot_token: t\n  chat_id: \"1\"\n  parse_mode: HTML\n"
+	if _, err := ParseRuleSet("forward.yaml", []byte(rule)); err == nil || !strings.Contains(err.Error(), "template") {
+		t.Errorf("未配置 template 时 parse_mode 应返回错误: %v", err)
+	}
+	if _, err := ParseRuleSet("forward.yaml", []byte(rule+"  template: '<b>{{.Number}}</b>'\n")); err != nil {
+		t.Errorf("配置 template 后应允许 parse_mode: %v", err)
+	}
+
+	// 验证码短信通常包含 . - ( !，MarkdownV2 模板中需要用 escapeMarkdownV2 转义
+	rule = "tg:\n  type: all\n  notify: telegram\n  bot_token: t\n  chat_id: \"1\"\n  api_url: " + srv.URL + "\n  parse_mode: MarkdownV2\n" +
+		"  template: |-\n    *{{escapeMarkdownV2 .Number}}*\n    {{escapeMarkdownV2 .Text}}\n"
+	set, err := ParseRuleSet("forward.yaml", []byte(rule))
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	tg, _ := set.Get("tg")
+	sms := tg.buildMessage(&MessageData{Number: "+86-10086", Text: "【银行】验证码 123456，5分钟内有效(勿泄露)! 详见 bank.com"})
+	if err := tg.notifier.Send(context.Background(), sms); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+	if want := "*\\+86\\-10086*\n【银行】验证码 123456，5分钟内有效\\(勿泄露\\)\\! 详见 bank\\.com"; got.ParseMode != "MarkdownV2" || got.Text != want {
+		t.Errorf("MarkdownV2 内容错误: %q, 期望: %q", got.Text, want)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"text/template"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	RegisterNotifier("webhook", func() Notifier { return &WebhookNotifier{} })
+}
+
+// WebhookNotifier 通用 HTTP 回调，请求方式、头、参数和请求体都可以在 forward.yaml 中配置。
+// headers、query、form 的值和 body 都是模板，可以使用消息模板的全部字段，另有 .Title/.Content/.Brief/.Body
+type WebhookNotifier struct {
+	URL             string            `yaml:"url" required:"true" doc:"回调地址"`
+	Method          string            `yaml:"method" enum:"GET,POST,PUT,PATCH,DELETE" default:"POST" doc:"请求方式"`
+	Headers         map[string]string `yaml:"headers" doc:"请求头，值可以使用模板"`
+	Query           map[string]string `yaml:"query" doc:"追加到地址上的查询参数，值可以使用模板"`
+	BodyType        string            `yaml:"body_type" enum:"json,form,plain" default:"json" doc:"请求体格式: json, form 表单 (使用 form 配置), plain 纯文本"`
+	Body            string            `yaml:"body" doc:"请求体模板，如 {\"text\": {{json .Text}}}；json 格式不填时发送完整消息"`
+	Form            map[string]string `yaml:"form" doc:"body_type 为 form 时的表单字段，值可以使用模板，不填时发送 title 和 content"`
+	ExpectStatus    []int             `yaml:"expect_status" doc:"视为成功的状态码，不填时为 2xx"`
+	Secret          string            `yaml:"secret" doc:"HMAC-SHA256 签名密钥，配置后对请求体签名"`
+	SignatureHeader string            `yaml:"signature_header" default:"X-Signature-256" doc:"签名请求头，值为 sha256=<hex>"`
+
+	body    *template.Template
+	headers map[string]*template.Template
+	query   map[string]*template.Template
+	form    map[string]*template.Template
+}
+
+// webhookData 回调模板的数据，包含消息模板的字段和已渲染的消息内容
+type webhookData struct {
+	MessageData
+	Title   string
+	Content string
+	Brief   string
+	Body    string
+}
+
+func newWebhookData(msg *Message) *webhookData {
+	d := &webhookData{Title: msg.Title, Content: msg.Content, Brief: msg.Brief, Body: msg.Body}
+	if msg.Data != nil {
+		d.MessageData = *msg.Data
+	}
+	return d
+}
+
+func (n *WebhookNotifier) Validate() error {
+	u, err := url.Parse(n.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("url 应为 http/https 地址: %s", n.URL)
+	}
+	if err := checkEnum("method", n.Method, "GET", "POST", "PUT", "PATCH", "DELETE"); err != nil {
+		return err
+	}
+	if err := checkEnum("body_type", n.BodyType, "json", "form", "plain"); err != nil {
+		return err
+	}
+	for _, code := range n.ExpectStatus {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("expect_status 状态码无效: %d", code)
+		}
+	}
+
+	sample := newWebhookData(&Message{Title: "短信通知", Content: "验证码 123456", Data: sampleMessageData})
+	if n.Body != "" {
+		if n.body, err = parseTemplate("body", n.Body, sample); err != nil {
+			return fmt.Errorf("body 模板错误: %v", err)
+		}
+	}
+	if n.headers, err = parseTemplateMap("headers", n.Headers, sample); err != nil {
+		return err
+	}
+	if n.query, err = parseTemplateMap("query", n.Query, sample); err != nil {
+		return err
+	}
+	if n.form, err = parseTemplateMap("form", n.Form, sample); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (n *WebhookNotifier) Send(ctx context.Context, msg *Message) error {
+	data := newWebhookData(msg)
+	method := n.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	u, err := url.Parse(n.URL)
+	if err != nil {
+		return &permanentError{fmt.Errorf("解析回调地址失败: %v", err)}
+	}
+	if len(n.query) > 0 {
+		q := u.Query()
+		for k, tmpl := range n.query {
+			q.Set(k, executeTemplate(tmpl, data))
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	body, contentType, err := n.buildBody(msg, data)
+	if err != nil {
+		return &permanentError{err}
+	}
+	var reader io.Reader
+	if method != http.MethodGet {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reader)
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %v", err)
+	}
+	if method != http.MethodGet {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for k, tmpl := range n.headers {
+		req.Header.Set(k, executeTemplate(tmpl, data))
+	}
+	if n.Secret != "" {
+		header := n.SignatureHeader
+		if header == "" {
+			header = "X-Signature-256"
+		}
+		req.Header.Set(header, "sha256="+signHMAC(n.Secret, body))
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	if !n.expected(resp.StatusCode) {
+		return &HTTPError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+	return nil
+}
+
+// buildBody 按 body_type 生成请求体，GET 请求的请求体只用于签名
+func (n *WebhookNotifier) buildBody(msg *Message, data *webhookData) ([]byte, string, error) {
+	switch n.BodyType {
+	case "form":
+		form := url.Values{}
+		if len(n.form) == 0 {
+			form.Set("title", msg.Title)
+			form.Set("content", msg.Content)
+		}
+		for k, tmpl := range n.form {
+			form.Set(k, executeTemplate(tmpl, data))
+		}
+		return []byte(form.Encode()), "application/x-www-form-urlencoded", nil
+	case "plain":
+		if n.body == nil {
+			return []byte(msg.Content), "text/plain; charset=utf-8", nil
+		}
+		return []byte(executeTemplate(n.body, data)), "text/plain; charset=utf-8", nil
+	}
+	if n.body == nil {
+		body, err := json.Marshal(msg)
+		return body, "application/json", err
+	}
+	body := []byte(executeTemplate(n.body, data))
+	if !json.Valid(body) {
+		return nil, "", fmt.Errorf("body 模板渲染结果不是合法的 JSON，字符串请使用 {{json .Text}}: %s", truncate(string(body), 200))
+	}
+	return body, "application/json", nil
+}
+
+// expected 判断状态码是否视为成功
+func (n *WebhookNotifier) expected(code int) bool {
+	if len(n.ExpectStatus) == 0 {
+		return code >= 200 && code < 300
+	}
+	for _, c := range n.ExpectStatus {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTemplateMap 解析 headers/query/form 中每个值的模板
+func parseTemplateMap(name string, src map[string]string, sample interface{}) (map[string]*template.Template, error) {
+	dst := make(map[string]*template.Template, len(src))
+	for k, v := range src {
+		tmpl, err := parseTemplate(k, v, sample)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s 模板错误: %v", name, k, err)
+		}
+		dst[k] = tmpl
+	}
+	return dst, nil
+}
+
+// executeTemplate 渲染模板，加载时已试渲染过，出错时记录日志并返回空字符串
+func executeTemplate(tmpl *template.Template, data interface{}) string {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		log.Warnf("模板 %s 渲染失败: %v", tmpl.Name(), err)
+		return ""
+	}
+	return buf.String()
+}
+
+// signHMAC 计算 HMAC-SHA256 签名，返回十六进制字符串
+func signHMAC(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
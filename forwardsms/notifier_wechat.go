@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+func init() {
+	RegisterNotifier("wechat", func() Notifier { return &WechatNotifier{} })
+}
+
+// WechatNotifier 企业微信群机器人
+type WechatNotifier struct {
+	URL    string `yaml:"url" required:"true" doc:"企业微信群机器人 webhook 地址"`
+	Format string `yaml:"format" enum:"text,markdown" default:"text" doc:"消息格式: text 纯文本, markdown 发送人、验证码和正文分开展示"`
+}
+
+func (n *WechatNotifier) Validate() error {
+	return checkEnum("format", n.Format, "text", "markdown")
+}
+
+func (n *WechatNotifier) Send(ctx context.Context, msg *Message) error {
+	type Content struct {
+		Content string `json:"content"`
+	}
+	type body struct {
+		Msgtype  string   `json:"msgtype"`
+		Text     *Content `json:"text,omitempty"`
+		Markdown *Content `json:"markdown,omitempty"`
+	}
+	var messend body
+	if n.Format == "markdown" {
+		messend = body{Msgtype: "markdown", Markdown: &Content{wecomMarkdown.render(msg)}}
+	} else {
+		messend = body{Msgtype: "text", Text: &Content{fmt.Sprintf("%s\n%s", msg.Title, msg.Content)}}
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	_, err := postJSON(ctx, client, n.URL, messend)
+	return err
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	RegisterNotifier("wecom_app", func() Notifier { return &WecomAppNotifier{} })
+}
+
+// WecomAppNotifier 企业微信自建应用，可以发给指定成员、部门或标签，成员关注微信插件后在个人微信中也能收到
+type WecomAppNotifier struct {
+	CorpID     string `yaml:"corpid" required:"true" doc:"企业 ID"`
+	CorpSecret string `yaml:"corpsecret" required:"true" doc:"应用的 Secret"`
+	AgentID    int    `yaml:"agentid" required:"true" doc:"应用的 AgentId"`
+	ToUser     string `yaml:"touser" doc:"接收成员 ID，多个用 | 分隔，@all 为全部成员"`
+	ToParty    string `yaml:"toparty" doc:"接收部门 ID，多个用 | 分隔"`
+	ToTag      string `yaml:"totag" doc:"接收标签 ID，多个用 | 分隔"`
+	Format     string `yaml:"format" enum:"text,markdown" default:"text" doc:"消息格式: text 纯文本, markdown (微信插件中不显示 markdown 消息)"`
+	APIURL     string `yaml:"api_url" default:"https://qyapi.weixin.qq.com" doc:"接口地址，使用代理转发时修改"`
+}
+
+// WecomAppRequest 应用消息请求
+type WecomAppRequest struct {
+	ToUser   string        `json:"touser,omitempty"`
+	ToParty  string        `json:"toparty,omitempty"`
+	ToTag    string        `json:"totag,omitempty"`
+	MsgType  string        `json:"msgtype"`
+	AgentID  int           `json:"agentid"`
+	Text     *WecomContent `json:"text,omitempty"`
+	Markdown *WecomContent `json:"markdown,omitempty"`
+}
+
+// WecomContent 文本和 markdown 消息的内容
+type WecomContent struct {
+	Content string `json:"content"`
+}
+
+// WecomResponse 企业微信接口的公共响应，errcode 不为 0 表示失败
+type WecomResponse struct {
+	ErrCode      int    `json:"errcode"`
+	ErrMsg       string `json:"errmsg"`
+	AccessToken  string `json:"access_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	InvalidUser  string `json:"invaliduser"`
+	InvalidParty string `json:"invalidparty"`
+	InvalidTag   string `json:"invalidtag"`
+}
+
+// wecomTokenInvalid access_token 无效或过期的错误码，需要重新获取
+var wecomTokenInvalid = map[int]bool{40001: true, 40014: true, 42001: true}
+
+// wecomPermanentErrors 重试也无法成功的错误：IP 不在可信 IP 列表 (60020)、接收人全部无效 (81013)、
+// agentid 不合法 (40056)、没有成员或应用权限 (60011、301002)
+var wecomPermanentErrors = map[int]bool{
+	60020:  true,
+	81013:  true,
+	40056:  true,
+	60011:  true,
+	301002: true,
+}
+
+func (n *WecomAppNotifier) Validate() error {
+	if n.ToUser == "" && n.ToParty == "" && n.ToTag == "" {
+		return fmt.Errorf("touser、toparty、totag 至少需要一项")
+	}
+	if n.APIURL != "" {
+		if _, err := url.Parse(n.APIURL); err != nil {
+			return fmt.Errorf("解析 api_url 失败: %v", err)
+		}
+	}
+	return checkEnum("format", n.Format, "text", "markdown")
+}
+
+func (n *WecomAppNotifier) apiURL() string {
+	if n.APIURL == "" {
+		return "https://qyapi.weixin.qq.com"
+	}
+	return strings.TrimSuffix(n.APIURL, "/")
+}
+
+func (n *WecomAppNotifier) Send(ctx context.Context, msg *Message) error {
+	payload := WecomAppRequest{ToUser: n.ToUser, ToParty: n.ToParty, ToTag: n.ToTag, MsgType: "text", AgentID: n.AgentID}
+	if n.Format == "markdown" {
+		payload.MsgType = "markdown"
+		payload.Markdown = &WecomContent{wecomMarkdown.render(msg)}
+	} else {
+		payload.Text = &WecomContent{fmt.Sprintf("%s\n%s", msg.Title, msg.Content)}
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	// token 在有效期内被重置时（如在后台重新生成了 Secret）会返回 40014 等错误，重新获取后再试一次
+	for retry := 0; ; retry++ {
+		token, err := wecomTokens.get(ctx, client, n.apiURL(), n.CorpID, n.CorpSecret)
+		if err != nil {
+			return err
+		}
+		body, err := postJSON(ctx, client, n.apiURL()+"/cgi-bin/message/send?access_token="+url.QueryEscape(token), payload)
+		if err != nil {
+			return err
+		}
+		var resp WecomResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return fmt.Errorf("解析响应失败: %v", err)
+		}
+		if wecomTokenInvalid[resp.ErrCode] && retry == 0 {
+			wecomTokens.invalidate(n.CorpID, n.CorpSecret)
+			continue
+		}
+		if resp.ErrCode != 0 {
+			err := fmt.Errorf("企业微信返回错误 errcode=%d: %w", resp.ErrCode, &HTTPError{StatusCode: http.StatusOK, Body: string(body)})
+			if wecomPermanentErrors[resp.ErrCode] {
+				return &permanentError{err}
+			}
+			return err
+		}
+		if resp.InvalidUser != "" || resp.InvalidParty != "" || resp.InvalidTag != "" {
+			log.Warnf("企业微信应用消息部分接收人无效: user=%s party=%s tag=%s", resp.InvalidUser, resp.InvalidParty, resp.InvalidTag)
+		}
+		return nil
+	}
+}
+
+// wecomTokenCache 按 corpid+secret 缓存 access_token，多条规则和热加载后共用，过期前 5 分钟刷新
+type wecomTokenCache struct {
+	mu     sync.Mutex
+	tokens map[string]wecomToken
+}
+
+type wecomToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+var wecomTokens = &wecomTokenCache{tokens: map[string]wecomToken{}}
+
+func (c *wecomTokenCache) get(ctx context.Context, client *http.Client, apiURL, corpID, secret string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := corpID + "/" + secret
+	if t, ok := c.tokens[key]; ok && time.Now().Before(t.expiresAt) {
+		return t.token, nil
+	}
+
+	u := fmt.Sprintf("%s/cgi-bin/gettoken?corpid=%s&corpsecret=%s", apiURL, url.QueryEscape(corpID), url.QueryEscape(secret))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", fmt.Errorf("创建请求失败: %v", err)
+	}
+	body, err := doRequest(client, req)
+	if err != nil {
+		return "", fmt.Errorf("获取 access_token 失败: %w", err)
+	}
+	var resp WecomResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("解析 access_token 响应失败: %v", err)
+	}
+	if resp.ErrCode != 0 || resp.AccessToken == "" {
+		err := fmt.Errorf("获取 access_token 失败: errcode=%d, %s", resp.ErrCode, resp.ErrMsg)
+		// corpid、secret 错误时重试也不会成功
+		if resp.ErrCode == 40013 || resp.ErrCode == 40001 || resp.ErrCode == 40091 {
+			return "", &permanentError{err}
+		}
+		return "", err
+	}
+	expires := time.Duration(resp.ExpiresIn)*time.Second - 5*time.Minute
+	c.tokens[key] = wecomToken{token: resp.AccessToken, expiresAt: time.Now().Add(expires)}
+	return resp.AccessToken, nil
+}
+
+func (c *wecomTokenCache) invalidate(corpID, secret string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.tokens, corpID+"/"+secret)
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	deliveryBucket   = []byte("deliveries")
+	deadLetterBucket = []byte("dead_letters")
+	metaBucket       = []byte("meta")
+)
+
+// errDeliveryNotFound 重放的死信不存在
+var errDeliveryNotFound = errors.New("死信不存在")
+
+// maxResponseBody 死信中保存的响应内容上限
+const maxResponseBody = 2048
+
+// Delivery 一条 规则×消息 的投递记录
+type Delivery struct {
+	ID          uint64    `json:"id"`
+	Rule        string    `json:"rule"`
+	Notify      string    `json:"notify"`
+	Message     Message   `json:"message"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error,omitempty"`
+	StatusCode  int       `json:"status_code,omitempty"` // 最后一次失败的 HTTP 状态码
+	Response    string    `json:"response,omitempty"`    // 最后一次失败的响应内容
+	CreatedAt   time.Time `json:"created_at"`
+	NextAttempt time.Time `json:"next_attempt"`
+	FailedAt    time.Time `json:"failed_at,omitzero"` // 进入死信的时间
+}
+
+// QueueOptions 投递队列参数
+type QueueOptions struct {
+	MaxAttempts int           // 最大投递次数，含首次
+	RetryBase   time.Duration // 首次重试间隔
+	RetryMax    time.Duration // 重试间隔上限
+	Lease       time.Duration // 投递中的记录在此时间内不会被重复领取
+}
+
+// DeliveryQueue 基于 BoltDB 的持久化投递队列，服务重启后未完成的投递会继续重试
+type DeliveryQueue struct {
+	db       *bolt.DB
+	opts     QueueOptions
+	instance string
+}
+
+// permanentError 不需要重试的错误，如规则已删除、渠道配置错误
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// OpenDeliveryQueue 打开（或创建）队列数据库
+func OpenDeliveryQueue(path string, opts QueueOptions) (*DeliveryQueue, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("创建队列目录失败: %v", err)
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("打开队列数据库失败: %v", err)
+	}
+	var instance string
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{deliveryBucket, deadLetterBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		instance, err = queueInstance(tx.Bucket(metaBucket))
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("初始化队列数据库失败: %v", err)
+	}
+	return &DeliveryQueue{db: db, opts: opts, instance: instance}, nil
+}
+
+// queueInstance 读取队列数据库的随机标识，第一次打开时生成。
+// 投递 ID 在删除数据库后会从 1 重新开始，加上标识后才能在不同数据库之间区分
+func queueInstance(meta *bolt.Bucket) (string, error) {
+	if v := meta.Get([]byte("instance")); v != nil {
+		return string(v), nil
+	}
+	b := make([]byte, 8)
+	if _, err := crand.Read(b); err != nil {
+		return "", err
+	}
+	instance := hex.EncodeToString(b)
+	return instance, meta.Put([]byte("instance"), []byte(instance))
+}
+
+// Instance 返回队列数据库的随机标识，与投递 ID 一起唯一确定一次投递
+func (q *DeliveryQueue) Instance() string {
+	return q.instance
+}
+
+// Close 关闭队列数据库
+func (q *DeliveryQueue) Close() error {
+	return q.db.Close()
+}
+
+// Enqueue 记录一条新的投递，返回的记录已被领取，调用方应立即投递并调用 Complete/Fail
+func (q *DeliveryQueue) Enqueue(rule, notify string, msg *Message) (*Delivery, error) {
+	now := time.Now()
+	d := &Delivery{
+		Rule:        rule,
+		Notify:      notify,
+		Message:     *msg,
+		CreatedAt:   now,
+		NextAttempt: now.Add(q.opts.Lease),
+	}
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(deliveryBucket)
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		d.ID = id
+		return putDelivery(b, d)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Complete 投递成功，删除记录
+func (q *DeliveryQueue) Complete(d *Delivery) error {
+	return q.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(deliveryBucket).Delete(itob(d.ID))
+	})
+}
+
+// Fail 记录一次投递失败，按指数退避安排下次重试；超过最大次数或不可重试时移入死信
+func (q *DeliveryQueue) Fail(d *Delivery, sendErr error) error {
+	d.Attempts++
+	d.LastError = sendErr.Error()
+	d.StatusCode, d.Response = 0, ""
+	var httpErr *HTTPError
+	if errors.As(sendErr, &httpErr) {
+		d.StatusCode = httpErr.StatusCode
+		d.Response = truncate(httpErr.Body, maxResponseBody)
+	}
+
+	var perm *permanentError
+	if errors.As(sendErr, &perm) || d.Attempts >= q.opts.MaxAttempts {
+		log.WithFields(log.Fields{
+			"id":       d.ID,
+			"rule":     d.Rule,
+			"notify":   d.Notify,
+			"attempts": d.Attempts,
+		}).Errorf("投递失败，移入死信: %v", sendErr)
+		d.FailedAt = time.Now()
+		return q.db.Update(func(tx *bolt.Tx) error {
+			if err := tx.Bucket(deliveryBucket).Delete(itob(d.ID)); err != nil {
+				return err
+			}
+			return putDelivery(tx.Bucket(deadLetterBucket), d)
+		})
+	}
+
+	d.NextAttempt = time.Now().Add(q.backoff(d.Attempts))
+	return q.db.Update(func(tx *bolt.Tx) error {
+		return putDelivery(tx.Bucket(deliveryBucket), d)
+	})
+}
+
+// Failed 返回死信中的全部投递记录
+func (q *DeliveryQueue) Failed() ([]*Delivery, error) {
+	failed := []*Delivery{}
+	err := q.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(deadLetterBucket).ForEach(func(k, v []byte) error {
+			var d Delivery
+			if err := json.Unmarshal(v, &d); err != nil {
+				return fmt.Errorf("解析死信 %d 失败: %v", binary.BigEndian.Uint64(k), err)
+			}
+			failed = append(failed, &d)
+			return nil
+		})
+	})
+	return failed, err
+}
+
+// Replay 将死信重新放回投递队列并清零重试次数，ids 为空时重放全部，返回重放数量
+func (q *DeliveryQueue) Replay(ids ...uint64) (int, error) {
+	var replayed int
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		dead := tx.Bucket(deadLetterBucket)
+		keys := make([][]byte, 0, len(ids))
+		for _, id := range ids {
+			keys = append(keys, itob(id))
+		}
+		if len(ids) == 0 {
+			dead.ForEach(func(k, _ []byte) error {
+				keys = append(keys, append([]byte(nil), k...))
+				return nil
+			})
+		}
+
+		now := time.Now()
+		for _, k := range keys {
+			v := dead.Get(k)
+			if v == nil {
+				return fmt.Errorf("%w: %d", errDeliveryNotFound, binary.BigEndian.Uint64(k))
+			}
+			var d Delivery
+			if err := json.Unmarshal(v, &d); err != nil {
+				return fmt.Errorf("解析死信 %d 失败: %v", binary.BigEndian.Uint64(k), err)
+			}
+			d.Attempts = 0
+			d.NextAttempt = now
+			d.FailedAt = time.Time{}
+			if err := putDelivery(tx.Bucket(deliveryBucket), &d); err != nil {
+				return err
+			}
+			if err := dead.Delete(k); err != nil {
+				return err
+			}
+			replayed++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return replayed, nil
+}
+
+// backoff 第 attempts 次失败后的等待时间：指数增长并加入随机抖动
+func (q *DeliveryQueue) backoff(attempts int) time.Duration {
+	delay := q.opts.RetryBase
+	for i := 1; i < attempts && delay < q.opts.RetryMax; i++ {
+		delay *= 2
+	}
+	if delay > q.opts.RetryMax {
+		delay = q.opts.RetryMax
+	}
+	// 保留一半固定等待，另一半随机，避免大量失败投递同时重试
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// claimDue 领取已到期的投递记录，领取后在 Lease 时间内不会被再次领取。
+// skip 返回 true 的记录仍在本进程内投递，跳过且不修改
+func (q *DeliveryQueue) claimDue(now time.Time, limit int, skip func(id uint64) bool) ([]*Delivery, error) {
+	var due []*Delivery
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(deliveryBucket)
+		c := b.Cursor()
+		for k, v := c.First(); k != nil && len(due) < limit; k, v = c.Next() {
+			var d Delivery
+			if err := json.Unmarshal(v, &d); err != nil {
+				log.Errorf("解析投递记录 %d 失败: %v", binary.BigEndian.Uint64(k), err)
+				continue
+			}
+			if d.NextAttempt.After(now) || (skip != nil && skip(d.ID)) {
+				continue
+			}
+			d.NextAttempt = now.Add(q.opts.Lease)
+			if err := putDelivery(b, &d); err != nil {
+				return err
+			}
+			due = append(due, &d)
+		}
+		return nil
+	})
+	return due, err
+}
+
+// Pending 返回队列中的记录数
+func (q *DeliveryQueue) Pending() int {
+	var n int
+	q.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(deliveryBucket).Stats().KeyN
+		return nil
+	})
+	return n
+}
+
+// FailedCount 返回死信数量
+func (q *DeliveryQueue) FailedCount() int {
+	var n int
+	q.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(deadLetterBucket).Stats().KeyN
+		return nil
+	})
+	return n
+}
+
+// Release 释放已领取但未能投递的记录，使其尽快被重新领取
+func (q *DeliveryQueue) Release(d *Delivery) error {
+	d.NextAttempt = time.Now()
+	return q.db.Update(func(tx *bolt.Tx) error {
+		return putDelivery(tx.Bucket(deliveryBucket), d)
+	})
+}
+
+func putDelivery(b *bolt.Bucket, d *Delivery) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return b.Put(itob(d.ID), data)
+}
+
+// truncate 截断过长的字符串，最多保留 n 字节，不会截断在多字节字符中间
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
+}
+
+// itob 将 ID 转为大端字节，保证 BoltDB 中按投递顺序排列
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+func testQueueOptions() QueueOptions {
+	return QueueOptions{
+		MaxAttempts: 3,
+		RetryBase:   time.Second,
+		RetryMax:    4 * time.Second,
+		Lease:       time.Minute,
+	}
+}
+
+func TestDeliveryQueueRetry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.db")
+	q, err := OpenDeliveryQueue(path, testQueueOptions())
+	if err != nil {
+		t.Fatalf("打开队列失败: %v", err)
+	}
+
+	d, err := q.Enqueue("bank", "wechat", &Message{Title: "短信通知", Content: "验证码 1234"})
+	if err != nil {
+		t.Fatalf("写入队列失败: %v", err)
+	}
+	// 刚写入的记录处于领取状态，不会被扫描到
+	if due, _ := q.claimDue(time.Now(), 10, nil); len(due) != 0 {
+		t.Fatalf("领取中的记录不应到期: %d", len(due))
+	}
+	if err := q.Fail(d, errors.New("timeout")); err != nil {
+		t.Fatalf("记录失败出错: %v", err)
+	}
+	q.Close()
+
+	// 重启后记录仍在
+	q, err = OpenDeliveryQueue(path, testQueueOptions())
+	if err != nil {
+		t.Fatalf("重新打开队列失败: %v", err)
+	}
+	defer q.Close()
+	due, err := q.claimDue(time.Now().Add(time.Second), 10, nil)
+	if err != nil || len(due) != 1 {
+		t.Fatalf("应有 1 条到期记录: %d, %v", len(due), err)
+	}
+	if due[0].Attempts != 1 || due[0].LastError != "timeout" || due[0].Message.Content != "验证码 1234" {
+		t.Fatalf("记录内容错误: %+v", due[0])
+	}
+
+	// 达到最大次数后移入死信，并保留最后一次的响应
+	q.Fail(due[0], errors.New("timeout"))
+	q.Fail(due[0], &HTTPError{StatusCode: 502, Body: "bad gateway"})
+	if n := q.Pending(); n != 0 {
+		t.Fatalf("超过最大次数后应移出队列, 剩余: %d", n)
+	}
+	failed, err := q.Failed()
+	if err != nil || len(failed) != 1 {
+		t.Fatalf("应有 1 条死信: %d, %v", len(failed), err)
+	}
+	if failed[0].StatusCode != 502 || failed[0].Response != "bad gateway" || failed[0].FailedAt.IsZero() {
+		t.Fatalf("死信内容错误: %+v", failed[0])
+	}
+
+	// 重放后回到投递队列并清零重试次数
+	if _, err := q.Replay(failed[0].ID + 100); !errors.Is(err, errDeliveryNotFound) {
+		t.Fatalf("重放不存在的死信应报错: %v", err)
+	}
+	if n, err := q.Replay(); n != 1 || err != nil {
+		t.Fatalf("重放全部应返回 1: %d, %v", n, err)
+	}
+	due, _ = q.claimDue(time.Now(), 10, nil)
+	if len(due) != 1 || due[0].Attempts != 0 || q.FailedCount() != 0 {
+		t.Fatalf("重放后状态错误: %d 条到期, 死信 %d", len(due), q.FailedCount())
+	}
+}
+
+func TestDeliveryQueueBackoff(t *testing.T) {
+	q := &DeliveryQueue{opts: testQueueOptions()}
+	cases := []struct {
+		attempts int
+		min, max time.Duration
+	}{
+		{1, 500 * time.Millisecond, time.Second},
+		{2, time.Second, 2 * time.Second},
+		{3, 2 * time.Second, 4 * time.Second},
+		{10, 2 * time.Second, 4 * time.Second},
+	}
+	for _, c := range cases {
+		for i := 0; i < 20; i++ {
+			if d := q.backoff(c.attempts); d < c.min || d > c.max {
+				t.Fatalf("第 %d 次失败的等待时间 %s 不在 [%s, %s]", c.attempts, d, c.min, c.max)
+			}
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	cases := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 3, "hel..."},
+		// "验" 占 3 字节，截断位置落在字符中间时回退到字符开头
+		{"验证码", 4, "验..."},
+		{"验证码", 2, "..."},
+	}
+	for _, c := range cases {
+		got := truncate(c.s, c.n)
+		if got != c.want || !utf8.ValidString(got) {
+			t.Fatalf("truncate(%q, %d) = %q, 期望 %q", c.s, c.n, got, c.want)
+		}
+	}
+}
+
+func TestAdminAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/failed", adminAuthMiddleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	get := func(secret string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/failed", nil)
+		if secret != "" {
+			req.Header.Set("X-Forward-Secret", secret)
+		}
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	t.Setenv("FORWARD_SECRET", "")
+	if code := get(""); code != http.StatusForbidden {
+		t.Fatalf("未配置密钥时管理接口应禁用, 状态码: %d", code)
+	}
+	t.Setenv("FORWARD_SECRET", "s3cret")
+	if code := get("wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("密钥错误应返回 401, 状态码: %d", code)
+	}
+	if code := get("s3cret"); code != http.StatusOK {
+		t.Fatalf("密钥正确应通过, 状态码: %d", code)
+	}
+}
+
+func TestDeliveryQueueInstance(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.db")
+	q, err := OpenDeliveryQueue(path, testQueueOptions())
+	if err != nil {
+		t.Fatalf("打开队列失败: %v", err)
+	}
+	instance := q.Instance()
+	q.Close()
+	if len(instance) != 16 {
+		t.Fatalf("队列标识格式错误: %q", instance)
+	}
+
+	// 重新打开同一个数据库时标识不变，新建的数据库标识不同
+	q, err = OpenDeliveryQueue(path, testQueueOptions())
+	if err != nil {
+		t.Fatalf("重新打开队列失败: %v", err)
+	}
+	defer q.Close()
+	if q.Instance() != instance {
+		t.Fatalf("重新打开后标识变化: %s -> %s", instance, q.Instance())
+	}
+	other, err := OpenDeliveryQueue(filepath.Join(t.TempDir(), "other.db"), testQueueOptions())
+	if err != nil {
+		t.Fatalf("打开队列失败: %v", err)
+	}
+	defer other.Close()
+	if other.Instance() == instance {
+		t.Fatalf("不同数据库的标识不应相同: %s", instance)
+	}
+}
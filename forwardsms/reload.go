@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// activeRules 当前生效的规则，热加载时整体替换
+	activeRules atomic.Pointer[RuleSet]
+	// reloadMu 保证同一时间只有一次重新加载
+	reloadMu sync.Mutex
+	// lastReloadError 最近一次热加载失败的原因，成功后清空
+	lastReloadError atomic.Value
+)
+
+// currentRules 返回当前生效的规则
+func currentRules() *RuleSet {
+	if set := activeRules.Load(); set != nil {
+		return set
+	}
+	return &RuleSet{byName: map[string]*Rule{}}
+}
+
+// setRules 替换当前规则并递增版本号
+func setRules(set *RuleSet) {
+	set.Version = currentRules().Version + 1
+	activeRules.Store(set)
+}
+
+// reloadRules 重新读取配置文件，校验失败时保留原有规则
+func reloadRules(path, reason string) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	logger := log.WithFields(log.Fields{"file": path, "reason": reason})
+	next, err := LoadRuleSet(path)
+	if err != nil {
+		lastReloadError.Store(err.Error())
+		logger.Errorf("重新加载推送配置失败，继续使用版本 %d 的规则: %v", currentRules().Version, err)
+		return
+	}
+	lastReloadError.Store("")
+	old := currentRules()
+	if next.Checksum == old.Checksum {
+		return
+	}
+
+	added, removed, changed := diffRuleSets(old, next)
+	setRules(next)
+	logger.WithFields(log.Fields{
+		"version": next.Version,
+		"added":   added,
+		"removed": removed,
+		"changed": changed,
+	}).Infof("推送配置已重新加载，共 %d 条规则", len(next.Rules))
+}
+
+// diffRuleSets 比较两次加载的规则，返回新增、删除和修改的规则名
+func diffRuleSets(old, next *RuleSet) (added, removed, changed []string) {
+	for _, r := range next.Rules {
+		prev, ok := old.Get(r.Name)
+		switch {
+		case !ok:
+			added = append(added, r.Name)
+		case prev.fingerprint != r.fingerprint:
+			changed = append(changed, r.Name)
+		}
+	}
+	for _, r := range old.Rules {
+		if _, ok := next.Get(r.Name); !ok {
+			removed = append(removed, r.Name)
+		}
+	}
+	return added, removed, changed
+}
+
+// watchConfig 监听配置文件变化和 SIGHUP 信号，触发重新加载
+func watchConfig(path string) {
+	viperconfig.OnConfigChange(func(e fsnotify.Event) {
+		reloadRules(path, "文件变化")
+	})
+	viperconfig.WatchConfig()
+
+	// 单文件挂载到容器时编辑器替换文件可能收不到通知，可以用 docker kill -s HUP 手动触发
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reloadRules(path, "SIGHUP")
+		}
+	}()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReloadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "forward.yaml")
+	write := func(data string) {
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a:\n  type: all\n  notify: bark\n  url: http://a\nb:\n  type: all\n  notify: bark\n  url: http://b\n")
+	set, err := LoadRuleSet(path)
+	if err != nil {
+		t.Fatalf("加载失败: %v", err)
+	}
+	old := currentRules()
+	defer activeRules.Store(old)
+	setRules(set)
+	version := currentRules().Version
+
+	// 修改 b、删除 a、新增 c
+	write("b:\n  type: all\n  notify: bark\n  url: http://b2\nc:\n  type: all\n  notify: bark\n  url: http://c\n")
+	next, _ := LoadRuleSet(path)
+	added, removed, changed := diffRuleSets(currentRules(), next)
+	if !reflect.DeepEqual(added, []string{"c"}) || !reflect.DeepEqual(removed, []string{"a"}) || !reflect.DeepEqual(changed, []string{"b"}) {
+		t.Fatalf("差异错误: added=%v removed=%v changed=%v", added, removed, changed)
+	}
+	reloadRules(path, "test")
+	if currentRules().Version != version+1 {
+		t.Fatalf("重新加载后版本应加一: %d", currentRules().Version)
+	}
+
+	// 无效配置保留原有规则
+	write("c:\n  type: all\n  notify: pigeon\n")
+	reloadRules(path, "test")
+	if currentRules().Version != version+1 || len(currentRules().Rules) != 2 {
+		t.Fatal("无效配置不应替换当前规则")
+	}
+	if msg, _ := lastReloadError.Load().(string); msg == "" {
+		t.Fatal("应记录热加载失败原因")
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// richField 富文本消息中单独展示的一项，如发送人、验证码
+type richField struct {
+	Label string
+	Value string
+	Code  bool // 验证码等需要突出显示、方便复制的内容
+}
+
+// richFields 从消息的原始字段中取出需要单独展示的项，队列中没有原始字段的旧消息返回空
+func richFields(msg *Message) []richField {
+	d := msg.Data
+	if d == nil {
+		return nil
+	}
+	var fields []richField
+	add := func(label, value string, code bool) {
+		if value != "" {
+			fields = append(fields, richField{Label: label, Value: value, Code: code})
+		}
+	}
+	if d.Call {
+		add("来电号码", d.Number, false)
+		add("联系人", d.Name, false)
+		add("类型", d.CallType, false)
+	} else {
+		add("发送人", d.Number, false)
+		add("验证码", d.verificationCode(), true)
+	}
+	add("接收卡", d.PhoneID, false)
+	add("时间", d.Time, false)
+	return fields
+}
+
+// richBody 富文本消息的正文，旧消息没有 Body 时使用完整内容
+func richBody(msg *Message) string {
+	if msg.Data == nil {
+		return msg.Content
+	}
+	return msg.Body
+}
+
+// markdownStyle 各渠道 Markdown 方言的差异：转义、加粗、验证码样式和换行
+type markdownStyle struct {
+	escape  func(string) string
+	bold    func(string) string
+	code    func(string) string
+	newline string
+}
+
+// render 生成 标题 / 字段列表 / 正文 三段式的消息
+func (s markdownStyle) render(msg *Message) string {
+	var b strings.Builder
+	b.WriteString(s.bold(s.escape(msg.Title)))
+	fields := richFields(msg)
+	if len(fields) > 0 {
+		b.WriteString(s.newline)
+	}
+	for _, f := range fields {
+		value := s.escape(f.Value)
+		if f.Code {
+			value = s.code(f.Value)
+		}
+		b.WriteString(s.newline)
+		b.WriteString(s.bold(s.escape(f.Label)) + ": " + value)
+	}
+	if body := richBody(msg); body != "" {
+		b.WriteString(s.newline + s.newline)
+		b.WriteString(strings.ReplaceAll(s.escape(body), "\n", s.newline))
+	}
+	return b.String()
+}
+
+func boldMarkdown(s string) string { return "**" + s + "**" }
+
+// wecomMarkdown 企业微信 markdown，验证码使用橙色字体
+var wecomMarkdown = markdownStyle{
+	escape:  escapeMarkdown,
+	bold:    boldMarkdown,
+	code:    func(s string) string { return `<font color="warning">` + escapeMarkdown(s) + `</font>` },
+	newline: "\n",
+}
+
+// dingtalkMarkdown 钉钉 markdown 需要两个空格加换行才会换行
+var dingtalkMarkdown = markdownStyle{
+	escape:  escapeMarkdown,
+	bold:    boldMarkdown,
+	code:    func(s string) string { return boldMarkdown(escapeMarkdown(s)) },
+	newline: "  \n",
+}
+
+// telegramMarkdownV2 Telegram MarkdownV2，验证码使用行内代码，点击即可复制
+var telegramMarkdownV2 = markdownStyle{
+	escape:  escapeMarkdownV2,
+	bold:    func(s string) string { return "*" + s + "*" },
+	code:    func(s string) string { return "`" + escapeMarkdownV2Code(s) + "`" },
+	newline: "\n",
+}
+
+// telegramHTML Telegram HTML 格式
+var telegramHTML = markdownStyle{
+	escape:  html.EscapeString,
+	bold:    func(s string) string { return "<b>" + s + "</b>" },
+	code:    func(s string) string { return "<code>" + html.EscapeString(s) + "</code>" },
+	newline: "\n",
+}
+
+// standardMarkdown 标准 Markdown (Server酱、PushPlus)，使用反斜杠转义
+var standardMarkdown = markdownStyle{
+	escape:  escapeCommonMark,
+	bold:    boldMarkdown,
+	code:    func(s string) string { return "`" + strings.ReplaceAll(s, "`", "") + "`" },
+	newline: "  \n",
+}
+
+// htmlMessage 网页展示的 HTML 格式 (PushPlus)
+var htmlMessage = markdownStyle{
+	escape:  html.EscapeString,
+	bold:    func(s string) string { return "<b>" + s + "</b>" },
+	code:    func(s string) string { return "<code>" + html.EscapeString(s) + "</code>" },
+	newline: "<br>\n",
+}
+
+// commonMarkEscaper 标准 Markdown 中会被解析的符号
+var commonMarkEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`,
+	"<", `\<`, ">", `\>`, "#", `\#`, "|", `\|`, "~", `\~`,
+)
+
+func escapeCommonMark(s string) string {
+	return commonMarkEscaper.Replace(s)
+}
+
+// markdownEscaper 企业微信、钉钉的 markdown 对反斜杠转义支持不完整，用全角字符替换会被解析的符号
+var markdownEscaper = strings.NewReplacer(
+	"*", "＊",
+	"_", "＿",
+	"`", "｀",
+	"#", "＃",
+	"[", "［",
+	"]", "］",
+	"<", "＜",
+	">", "＞",
+)
+
+// markdownURL 短信中的链接，转义后无法打开，原样保留
+var markdownURL = regexp.MustCompile(`https?://[!-~]+`)
+
+func escapeMarkdown(s string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range markdownURL.FindAllStringIndex(s, -1) {
+		b.WriteString(markdownEscaper.Replace(s[last:loc[0]]))
+		b.WriteString(s[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	b.WriteString(markdownEscaper.Replace(s[last:]))
+	return b.String()
+}
+
+// markdownV2Escaper MarkdownV2 要求以下字符全部使用反斜杠转义
+var markdownV2Escaper = strings.NewReplacer(
+	`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+	"~", `\~`, "`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`,
+	"|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+)
+
+func escapeMarkdownV2(s string) string {
+	return markdownV2Escaper.Replace(s)
+}
+
+// escapeMarkdownV2Code 行内代码中只需要转义 ` 和 \
+func escapeMarkdownV2Code(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "`", "\\`").Replace(s)
+}
+
+// larkEscaper 飞书 lark_md 使用 HTML 实体转义特殊字符
+var larkEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	"*", "&#42;",
+	"_", "&#95;",
+	"~", "&#126;",
+	"`", "&#96;",
+	"[", "&#91;",
+	"]", "&#93;",
+)
+
+func escapeLarkMD(s string) string {
+	return larkEscaper.Replace(s)
+}
+
+// feishuCard 飞书消息卡片：标题、字段两列展示、正文
+func feishuCard(msg *Message) map[string]interface{} {
+	color := "blue"
+	if msg.Data != nil && msg.Data.Call {
+		color = "orange"
+	}
+	var elements []interface{}
+	if fields := richFields(msg); len(fields) > 0 {
+		var items []interface{}
+		for _, f := range fields {
+			value := escapeLarkMD(f.Value)
+			if f.Code {
+				value = fmt.Sprintf("<font color='red'>%s</font>", value)
+			}
+			items = append(items, map[string]interface{}{
+				"is_short": true,
+				"text":     map[string]interface{}{"tag": "lark_md", "content": fmt.Sprintf("**%s**\n%s", f.Label, value)},
+			})
+		}
+		elements = append(elements, map[string]interface{}{"tag": "div", "fields": items})
+	}
+	if body := richBody(msg); body != "" {
+		if len(elements) > 0 {
+			elements = append(elements, map[string]interface{}{"tag": "hr"})
+		}
+		elements = append(elements, map[string]interface{}{
+			"tag":  "div",
+			"text": map[string]interface{}{"tag": "plain_text", "content": body},
+		})
+	}
+	return map[string]interface{}{
+		"config": map[string]interface{}{"wide_screen_mode": true},
+		"header": map[string]interface{}{
+			"title":    map[string]interface{}{"tag": "plain_text", "content": msg.Title},
+			"template": color,
+		},
+		"elements": elements,
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func richMessage() *Message {
+	rule := &Rule{Name: "code"}
+	return rule.buildMessage(&MessageData{
+		Number:  "1069001",
+		Time:    "2024-01-01 12:00:00",
+		Text:    "【银行】验证码 123456，*勿告诉他人* (5min).",
+		PhoneID: "SMS1",
+		Code:    "123456",
+	})
+}
+
+func TestMarkdownRender(t *testing.T) {
+	msg := richMessage()
+	cases := []struct {
+		name  string
+		style markdownStyle
+		want  string
+	}{
+		{"企业微信", wecomMarkdown, "**短信通知**\n\n**发送人**: 1069001\n**验证码**: <font color=\"warning\">123456</font>\n**接收卡**: SMS1\n**时间**: 2024-01-01 12:00:00\n\n【银行】验证码 123456，＊勿告诉他人＊ (5min)."},
+		{"Telegram MarkdownV2", telegramMarkdownV2, "*短信通知*\n\n*发送人*: 1069001\n*验证码*: `123456`\n*接收卡*: SMS1\n*时间*: 2024\\-01\\-01 12:00:00\n\n【银行】验证码 123456，\\*勿告诉他人\\* \\(5min\\)\\."},
+		{"Telegram HTML", telegramHTML, "<b>短信通知</b>\n\n<b>发送人</b>: 1069001\n<b>验证码</b>: <code>123456</code>\n<b>接收卡</b>: SMS1\n<b>时间</b>: 2024-01-01 12:00:00\n\n【银行】验证码 123456，*勿告诉他人* (5min)."},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.style.render(msg); got != c.want {
+				t.Fatalf("渲染结果:\n%s\n期望:\n%s", got, c.want)
+			}
+		})
+	}
+
+	// 队列中旧的消息没有原始字段，只展示标题和完整内容
+	old := &Message{Title: "短信通知", Content: "a<b>"}
+	if got := telegramHTML.render(old); got != "<b>短信通知</b>\n\na&lt;b&gt;" {
+		t.Fatalf("旧消息渲染结果: %q", got)
+	}
+}
+
+func TestRichFieldsCode(t *testing.T) {
+	// 没有验证码关键字的短信不显示验证码字段，即使队列中保存了旧版本提取的 Code
+	msg := &Message{Title: "短信通知", Data: &MessageData{Number: "95588", Text: "您尾号1234的卡消费2000元", Code: "1234"}}
+	for _, f := range richFields(msg) {
+		if f.Code || f.Label == "验证码" {
+			t.Fatalf("不应显示验证码: %+v", f)
+		}
+	}
+}
+
+func TestEscapeMarkdownURL(t *testing.T) {
+	got := escapeMarkdown("点击https://example.com/a_b*c?x=[1]，查看_详情_ http://t.cn/x_y")
+	want := "点击https://example.com/a_b*c?x=[1]，查看＿详情＿ http://t.cn/x_y"
+	if got != want {
+		t.Errorf("链接不应转义:\n%s\n期望:\n%s", got, want)
+	}
+}
+
+func TestRichNotifierPayload(t *testing.T) {
+	var got map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = nil
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok","code":0,"msg":"success"}`))
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		name     string
+		notifier Notifier
+		msgtype  string
+		field    string
+	}{
+		{"企业微信 markdown", &WechatNotifier{URL: srv.URL, Format: "markdown"}, "markdown", "markdown"},
+		{"钉钉 markdown", &DingtalkNotifier{URL: srv.URL, Format: "markdown"}, "markdown", "markdown"},
+		{"钉钉 actionCard", &DingtalkNotifier{URL: srv.URL, Format: "action_card", ActionURL: "https://example.com"}, "actionCard", "actionCard"},
+		{"飞书卡片", &FeishuNotifier{URL: srv.URL, Format: "card"}, "interactive", "card"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := c.notifier.Send(context.Background(), richMessage()); err != nil {
+				t.Fatalf("发送失败: %v", err)
+			}
+			msgtype := got["msgtype"]
+			if msgtype == nil {
+				msgtype = got["msg_type"]
+			}
+			if msgtype != c.msgtype || got[c.field] == nil {
+				t.Fatalf("请求内容错误: %v", got)
+			}
+		})
+	}
+}
+
+func TestRichFormatValidate(t *testing.T) {
+	for _, n := range []Notifier{
+		&WechatNotifier{Format: "card"},
+		&FeishuNotifier{Format: "markdown"},
+		&TelegramNotifier{Format: "MarkdownV2"},
+		&DingtalkNotifier{Format: "action_card"},
+	} {
+		if err := n.Validate(); err == nil {
+			t.Errorf("应返回错误: %#v", n)
+		}
+	}
+}
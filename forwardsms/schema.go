@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+//go:generate sh -c "go run . -schema > ../data/config/forward.schema.json"
+
+// GenerateSchema 根据规则和各推送渠道的配置结构生成 forward.yaml 的 JSON Schema，供编辑器补全和校验
+func GenerateSchema() ([]byte, error) {
+	properties := map[string]interface{}{}
+	var allOf []interface{}
+
+	merge := func(name string, prop map[string]interface{}) {
+		existing, ok := properties[name].(map[string]interface{})
+		if !ok {
+			// 各渠道的同名配置项说明不同，这里只保留类型，说明放在各渠道的 then 中
+			general := map[string]interface{}{}
+			for k, v := range prop {
+				if k != "description" && k != "default" {
+					general[k] = v
+				}
+			}
+			properties[name] = general
+			return
+		}
+		if !reflect.DeepEqual(existing["type"], prop["type"]) {
+			delete(existing, "type")
+			delete(existing, "items")
+		}
+		// 可选值不同时（如各渠道的 format）只在各渠道的 then 中限制
+		if !reflect.DeepEqual(existing["enum"], prop["enum"]) {
+			delete(existing, "enum")
+		}
+	}
+
+	ruleProps, ruleRequired := schemaProperties(reflect.TypeOf(Rule{}))
+	for name, prop := range ruleProps {
+		properties[name] = prop
+	}
+	properties["notify"].(map[string]interface{})["enum"] = NotifierNames()
+
+	for _, name := range NotifierNames() {
+		props, required := schemaProperties(reflect.TypeOf(notifierFactories[name]()).Elem())
+		for field, prop := range props {
+			merge(field, prop.(map[string]interface{}))
+		}
+		then := map[string]interface{}{"properties": props}
+		if len(required) > 0 {
+			then["required"] = required
+		}
+		allOf = append(allOf, map[string]interface{}{
+			"if": map[string]interface{}{
+				"properties": map[string]interface{}{"notify": map[string]interface{}{"const": name}},
+				"required":   []string{"notify"},
+			},
+			"then": then,
+		})
+	}
+
+	schema := map[string]interface{}{
+		"$schema":     "http://json-schema.org/draft-07/schema#",
+		"title":       "forwardsms 转发规则 (forward.yaml)",
+		"description": "键为规则名称，值为规则配置",
+		"type":        "object",
+		"additionalProperties": map[string]interface{}{
+			"$ref": "#/definitions/rule",
+		},
+		"definitions": map[string]interface{}{
+			"condition": schemaStruct(reflect.TypeOf(Condition{})),
+			"rule": map[string]interface{}{
+				"type":                 "object",
+				"properties":           properties,
+				"required":             ruleRequired,
+				"allOf":                allOf,
+				"additionalProperties": false,
+			},
+		},
+	}
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// schemaProperties 生成结构体各 yaml 字段的 schema 及必填字段
+func schemaProperties(t reflect.Type) (map[string]interface{}, []string) {
+	props := map[string]interface{}{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("yaml")
+		if !f.IsExported() || tag == "" || tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if opts == "inline" {
+			sub, subRequired := schemaProperties(f.Type)
+			for k, v := range sub {
+				props[k] = v
+			}
+			required = append(required, subRequired...)
+			continue
+		}
+		prop := schemaType(f.Type)
+		// 兼容多种 YAML 写法的字段，如未加引号的端口号
+		if types := f.Tag.Get("types"); types != "" {
+			prop["type"] = strings.Split(types, ",")
+		}
+		if doc := f.Tag.Get("doc"); doc != "" {
+			prop["description"] = doc
+		}
+		if enum := f.Tag.Get("enum"); enum != "" {
+			prop["enum"] = strings.Split(enum, ",")
+		}
+		if def := f.Tag.Get("default"); def != "" {
+			prop["default"] = def
+		}
+		if f.Tag.Get("required") == "true" {
+			required = append(required, name)
+		}
+		props[name] = prop
+	}
+	sort.Strings(required)
+	return props, required
+}
+
+// schemaProvider 自定义 YAML 写法的类型自行提供 schema
+type schemaProvider interface {
+	JSONSchema() map[string]interface{}
+}
+
+// schemaType Go 类型对应的 JSON Schema 类型
+func schemaType(t reflect.Type) map[string]interface{} {
+	if p, ok := reflect.Zero(t).Interface().(schemaProvider); ok && t.Kind() != reflect.Ptr {
+		return p.JSONSchema()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": schemaType(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaType(t.Elem())}
+	case reflect.Struct:
+		return schemaStruct(t)
+	case reflect.Ptr:
+		return schemaType(t.Elem())
+	}
+	return map[string]interface{}{}
+}
+
+// schemaStruct 结构体对应的 object schema
+func schemaStruct(t reflect.Type) map[string]interface{} {
+	props, required := schemaProperties(t)
+	s := map[string]interface{}{"type": "object", "properties": props, "additionalProperties": false}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
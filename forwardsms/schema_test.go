@@ -0,0 +1,21 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestSchemaUpToDate(t *testing.T) {
+	want, err := GenerateSchema()
+	if err != nil {
+		t.Fatalf("生成 schema 失败: %v", err)
+	}
+	got, err := os.ReadFile("../data/config/forward.schema.json")
+	if err != nil {
+		t.Fatalf("读取 schema 失败: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("forward.schema.json 已过期，请执行 go generate 重新生成")
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// MessageData 消息模板可以使用的字段，短信和来电共用
+type MessageData struct {
+	Call     bool   `json:"call"`      // 是否来电
+	RuleName string `json:"rule_name"` // 规则名称
+	Rule     string `json:"rule"`      // 规则的关键字、正则或表达式
+	Number   string `json:"number"`    // 发送人或来电号码
+	Time     string `json:"time"`      // 请求中的时间
+	Text     string `json:"text"`      // 短信内容
+	PhoneID  string `json:"phone_id"`  // 接收的 SIM 卡标识
+	Source   string `json:"source"`    // 来源
+	SMSID    string `json:"sms_id"`    // 短信 ID
+	Name     string `json:"name"`      // 来电联系人名称
+	CallType string `json:"call_type"` // 来电类型
+	Duration int    `json:"duration"`  // 通话时长（秒）
+	Code     string `json:"code"`      // 提取的验证码，短信不含验证码关键字时为空
+
+	Timestamp string `json:"timestamp"` // 请求中的时间戳
+}
+
+// verificationCode 短信含验证码关键字时提取的验证码，来电和普通短信为空。
+// 各渠道按短信内容重新判断，不使用队列中旧版本保存的 Code
+func (d *MessageData) verificationCode() string {
+	if d.Call {
+		return ""
+	}
+	return detectVerificationCode(d.Text)
+}
+
+// 默认模板与之前固定的消息格式保持一致
+const (
+	defaultSMSTemplate       = "触发规则: {{.Rule}}\n发送时间: {{.Time}}\n发送人: {{.Number}} \nphoneID: {{.PhoneID}}\n短信内容: {{.Text}}\nSource: {{.Source}}"
+	defaultSMSBriefTemplate  = "{{.Text}}\n{{.PhoneID}}\n{{.Time}}\n{{.Source}}"
+	defaultCallTemplate      = "发送时间: {{.Time}}\n发送人: {{.Number}} \n{{.CallType}}\nphoneID: {{.PhoneID}}\nName: {{.Name}}\nSource: {{.Source}}"
+	defaultCallBriefTemplate = "{{.Number}}\n{{.CallType}}\n{{.PhoneID}}\n{{.Time}}\n{{.Name}}\n{{.Source}}"
+)
+
+var (
+	smsTemplate       = template.Must(parseMessageTemplate("sms", defaultSMSTemplate))
+	smsBriefTemplate  = template.Must(parseMessageTemplate("sms_brief", defaultSMSBriefTemplate))
+	callTemplate      = template.Must(parseMessageTemplate("call", defaultCallTemplate))
+	callBriefTemplate = template.Must(parseMessageTemplate("call_brief", defaultCallBriefTemplate))
+)
+
+// templateFuncs 模板中可以使用的辅助函数
+var templateFuncs = template.FuncMap{
+	"code":       detectVerificationCode, // 与 .Code 一致，不含验证码关键字时为空
+	"mask":       maskNumber,
+	"formatTime": formatTime,
+	"truncate":   truncateRunes,
+	"json":       toJSON,
+	// Telegram parse_mode: MarkdownV2 时转义短信内容中的 . - ( ! 等字符，HTML 使用内置的 html 函数
+	"escapeMarkdownV2": escapeMarkdownV2,
+}
+
+// parseMessageTemplate 解析消息模板，并用示例数据试渲染一次，提前发现字段名写错等问题
+func parseMessageTemplate(name, text string) (*template.Template, error) {
+	return parseTemplate(name, text, sampleMessageData)
+}
+
+// sampleMessageData 加载配置时试渲染模板使用的示例数据
+var sampleMessageData = &MessageData{Number: "10086", Time: "2024-01-01 12:00:00", Text: "验证码 123456", Code: "123456"}
+
+// parseTemplate 解析模板并用 sample 试渲染
+func parseTemplate(name, text string, sample interface{}) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(&bytes.Buffer{}, sample); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// renderTemplate 渲染模板，失败时使用默认模板
+func renderTemplate(tmpl, fallback *template.Template, data *MessageData) string {
+	if tmpl == nil {
+		tmpl = fallback
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		log.WithField("rule", data.RuleName).Warnf("模板渲染失败，使用默认格式: %v", err)
+		buf.Reset()
+		fallback.Execute(&buf, data)
+	}
+	return buf.String()
+}
+
+// buildMessage 按规则的 template/title_template 生成推送消息。
+// 配置了 template 时，bark/gotify 等移动端推送的精简内容也使用同一模板
+func (r *Rule) buildMessage(data *MessageData) *Message {
+	msg := &Message{Title: "短信通知", MobileTitle: data.Number, Body: data.Text, Data: data}
+	content, brief := smsTemplate, smsBriefTemplate
+	if data.Call {
+		msg.Title, msg.MobileTitle = "来电通知", "来电通知"
+		content, brief = callTemplate, callBriefTemplate
+	}
+	if r.template != nil {
+		msg.Content = renderTemplate(r.template, content, data)
+		msg.Brief = msg.Content
+		msg.Body = msg.Content
+	} else {
+		msg.Content = renderTemplate(nil, content, data)
+		msg.Brief = renderTemplate(nil, brief, data)
+	}
+	if r.titleTemplate != nil {
+		var buf bytes.Buffer
+		if err := r.titleTemplate.Execute(&buf, data); err != nil {
+			log.WithField("rule", r.Name).Warnf("title_template 渲染失败，使用默认标题: %v", err)
+		} else {
+			msg.Title = strings.TrimSpace(buf.String())
+			msg.MobileTitle = msg.Title
+		}
+	}
+	return msg
+}
+
+// maskNumber 隐藏号码中间部分，如 138****0000，较短的号码只保留首尾各一位
+func maskNumber(number string) string {
+	runes := []rune(number)
+	keepHead, keepTail := 3, 4
+	if len(runes) <= keepHead+keepTail {
+		keepHead, keepTail = 1, 1
+	}
+	if len(runes) <= keepHead+keepTail {
+		return number
+	}
+	return string(runes[:keepHead]) + strings.Repeat("*", len(runes)-keepHead-keepTail) + string(runes[len(runes)-keepTail:])
+}
+
+// formatTime 按 Go 时间格式重新格式化请求中的时间，如 {{formatTime "01-02 15:04" .Time}}
+func formatTime(layout, value string) string {
+	return parseEventTime(value).Format(layout)
+}
+
+// truncateRunes 按字符截断，超出部分用 … 表示
+func truncateRunes(n int, s string) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "…"
+}
+
+// toJSON 将值序列化为 JSON，用于在 JSON 模板中安全地插入字符串，如 {"text": {{json .Text}}}
+func toJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
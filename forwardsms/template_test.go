@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDefaultTemplates(t *testing.T) {
+	rule := &Rule{Name: "all", Rule: "验证码"}
+	data := &MessageData{Rule: "验证码", Number: "10086", Time: "2024-01-01 12:00:00", Text: "验证码 123456", PhoneID: "SMS1", Source: "gammu"}
+	msg := rule.buildMessage(data)
+	want := &Message{
+		Title:       "短信通知",
+		MobileTitle: "10086",
+		Content:     fmt.Sprintf("触发规则: %s\n发送时间: %s\n发送人: %s \nphoneID: %s\n短信内容: %s\nSource: %s", "验证码", data.Time, "10086", "SMS1", data.Text, "gammu"),
+		Brief:       fmt.Sprintf("%s\n%s\n%s\n%s", data.Text, "SMS1", data.Time, "gammu"),
+	}
+	msg.Body, msg.Data = "", nil
+	if *msg != *want {
+		t.Fatalf("短信默认格式不一致:\n%#v\n%#v", msg, want)
+	}
+
+	call := &MessageData{Call: true, Number: "13800000000", Time: "2024-01-01 12:00:00", CallType: "missed", PhoneID: "SMS1", Name: "张三", Source: "gammu"}
+	msg = rule.buildMessage(call)
+	want = &Message{
+		Title:       "来电通知",
+		MobileTitle: "来电通知",
+		Content:     fmt.Sprintf("发送时间: %s\n发送人: %s \n%s\nphoneID: %s\nName: %s\nSource: %s", call.Time, call.Number, "missed", "SMS1", "张三", "gammu"),
+		Brief:       fmt.Sprintf("%s\n%s\n%s\n%s\n%s\n%s", call.Number, "missed", "SMS1", call.Time, "张三", "gammu"),
+	}
+	msg.Body, msg.Data = "", nil
+	if *msg != *want {
+		t.Fatalf("来电默认格式不一致:\n%#v\n%#v", msg, want)
+	}
+}
+
+func TestRuleTemplate(t *testing.T) {
+	data := `
+code:
+  type: all
+  notify: bark
+  url: http://x
+  title_template: '{{if .Call}}来电{{else}}验证码 {{.Code}}{{end}}'
+  template: '{{mask .Number}} {{formatTime "01-02 15:04" .Time}} {{code .Text}} {{truncate 3 .Text}}'
+`
+	set, err := ParseRuleSet("forward.yaml", []byte(data))
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	rule, _ := set.Get("code")
+	msg := rule.buildMessage(&MessageData{Number: "13800001234", Time: "2024-03-05 08:09:10", Text: "验证码 654321", Code: "654321"})
+	if msg.Title != "验证码 654321" || msg.MobileTitle != msg.Title {
+		t.Errorf("标题: %q", msg.Title)
+	}
+	if want := "138****1234 03-05 08:09 654321 验证码…"; msg.Content != want || msg.Brief != want {
+		t.Errorf("内容: %q, 期望 %q", msg.Content, want)
+	}
+
+	// 不含验证码关键字时 code 与 .Code 一样为空，卡号尾号不会被当作验证码
+	msg = rule.buildMessage(&MessageData{Number: "95588", Time: "2024-03-05 08:09:10", Text: "尾号1234消费"})
+	if want := "9***8 03-05 08:09  尾号1…"; msg.Content != want {
+		t.Errorf("内容: %q, 期望 %q", msg.Content, want)
+	}
+}
+
+func TestMaskNumber(t *testing.T) {
+	for in, want := range map[string]string{
+		"13800001234":    "138****1234",
+		"+8613800001234": "+86*******1234",
+		"10086":          "1***6",
+		"95":             "95",
+	} {
+		if got := maskNumber(in); got != want {
+			t.Errorf("maskNumber(%q) = %q, 期望 %q", in, got, want)
+		}
+	}
+}
+
+func TestRuleTemplateErrors(t *testing.T) {
+	for _, tmpl := range []string{
+		`{{.Text`,
+		`{{.Sender}}`,
+		`{{unknown .Text}}`,
+	} {
+		data := "bad:\n  notify: bark\n  url: http://x\n  type: all\n  template: '" + tmpl + "'\n"
+		_, err := ParseRuleSet("forward.yaml", []byte(data))
+		if err == nil || !strings.Contains(err.Error(), "template 错误") {
+			t.Errorf("应返回模板错误: %s, 实际 %v", tmpl, err)
+		}
+	}
+}